@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"math/big"
 	"monkey/token"
 	"strings"
 )
@@ -11,6 +13,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the node's token in the source
 }
 
 // Statement s are like variable bindings // let
@@ -57,6 +60,13 @@ type ExpressionStatement struct {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // the value when it doesn't fit into an int64, nil otherwise
+}
+
+// FloatLiteral Expression
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
 }
 
 type PrefixExpression struct {
@@ -93,6 +103,7 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier // list of parameter pointers
 	Body       *BlockStatement
+	Name       string // name of the let binding, empty for anonymous functions
 }
 
 type CallExpression struct {
@@ -106,6 +117,13 @@ type StringLiteral struct {
 	Value string
 }
 
+// InterpolatedString is a string with ${...} in it, the parts are the
+// StringLiterals between the interpolations and the interpolated expressions
+type InterpolatedString struct {
+	Token token.Token // the STRING_HEAD token
+	Parts []Expression
+}
+
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
@@ -118,9 +136,81 @@ type IndexExpression struct {
 	Index Expression  // the index of the object
 }
 
+// SliceExpression is arr[start:end], Start and End are nil when they are left out
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+// TryExpression evaluates Block, if it fails the error is bound to Parameter
+// and Catch is evaluated instead
+type TryExpression struct {
+	Token     token.Token // the 'try' token
+	Block     *BlockStatement
+	Parameter *Identifier // the caught error
+	Catch     *BlockStatement
+}
+
+// ImportStatement binds the exports of the module at Path to Name,
+// import "lib" as l
+type ImportStatement struct {
+	Token token.Token // the 'import' token
+	Path  string
+	Name  *Identifier // given with as, the file name of Path without its extension otherwise
+}
+
+// ExportStatement exports the binding of its let statement from a module
+type ExportStatement struct {
+	Token     token.Token // the 'export' token
+	Statement *LetStatement
+}
+
+// ThrowStatement raises Value as an error
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+// AssignExpression stores Value in Target, an identifier or an index expression,
+// Operator is "=", "+=" or "-="
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+// WhileStatement runs Body as long as Condition is truthy
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+// ForStatement runs Body once for every element of Iterable, bound to Variable
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+// BreakStatement leaves the innermost loop
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+// ContinueStatement starts the next iteration of the innermost loop
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
 type HashLiteral struct {
 	Token token.Token               // the '{' token
 	Pairs map[Expression]Expression // Go map of expressions
+	Keys  []Expression              // the keys of Pairs in source order
 }
 
 // Interface methods for
@@ -132,6 +222,7 @@ type HashLiteral struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
@@ -141,50 +232,120 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Token.Pos }
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) Pos() token.Position  { return es.Token.Pos }
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 
 // String implementations for
 //   - Program
@@ -236,6 +397,8 @@ func (es *ExpressionStatement) String() string {
 
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 func (i *Identifier) String() string { return i.Value }
 
 func (pe *PrefixExpression) String() string {
@@ -295,6 +458,9 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -323,6 +489,22 @@ func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
 
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -350,12 +532,30 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -364,3 +564,74 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Parameter.String())
+	out.WriteString(") ")
+	out.WriteString(te.Catch.String())
+
+	return out.String()
+}
+
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("import %q as %s;", is.Path, is.Name.String())
+}
+
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (bs *BreakStatement) String() string    { return bs.TokenLiteral() + ";" }
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bytecodeExt is the extension of compiled monkey scripts
+const bytecodeExt = ".mkc"
+
+// buildFile compiles the script at path and writes the bytecode to output.
+// An empty output writes next to the script, with the extension replaced by .mkc
+func buildFile(path, output string, stderr io.Writer) int {
+	program, code := parseFile(path, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	bytecode, code := compileProgram(path, program, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return exitCompileError
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + bytecodeExt
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// execFile loads the bytecode written by buildFile and runs it in the vm
+func execFile(path string, scriptArgs []string, stdout, stderr io.Writer) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return exitUsage
+	}
+
+	return runBytecode(bytecode, newArgsArray(scriptArgs), stdout, stderr)
+}
+
+// disasmFile prints the disassembly of a bytecode file,
+// or of the bytecode compiled from a script
+func disasmFile(path string, stdout, stderr io.Writer) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+
+	bytecode := &compiler.Bytecode{}
+	if bytes.HasPrefix(data, compiler.BytecodeMagic) {
+		if err := bytecode.UnmarshalBinary(data); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return exitUsage
+		}
+	} else {
+		program, code := parseSource(path, string(data), stderr)
+		if code != exitOK {
+			return code
+		}
+		bytecode, code = compileProgram(path, program, stderr)
+		if code != exitOK {
+			return code
+		}
+	}
+
+	fmt.Fprint(stdout, bytecode.Disassemble())
+	return exitOK
+}
@@ -43,6 +43,32 @@ const (
 	OpReturn
 	OpGetLocal
 	OpSetLocal
+	OpClosure
+	OpGetFree
+	OpGetBuiltin
+	OpCurrentClosure
+	OpThrow
+	OpIter
+	OpIterNext
+	OpSetIndex
+	OpDup
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpGreaterEqual
+	OpJumpIfFalsyOrPop
+	OpJumpIfTruthyOrPop
+	OpInterpolate
+	OpSlice
+	OpModule
+	OpCaptureLocal
+	OpCaptureFree
+	OpSetFree
+	OpLessThan
+	OpLessEqual
 )
 
 // maping opcode definitions
@@ -88,8 +114,11 @@ var definitions = map[Opcode]*Definition{
 	// +---------------+
 	// | OpGreaterThan | no operands, compares 2 topmost from stack
 	// +---------------+
-	// we don't need OpLessThan because with compilation instead of interpretation
-	// we can use reordering of code
+	OpLessThan: {"OpLessThan", []int{}},
+	// +------------+
+	// | OpLessThan | no operands, compares 2 topmost from stack
+	// +------------+
+	// not compiled as a swapped OpGreaterThan, the left operand is evaluated first
 	OpMinus: {"OpMinus", []int{}},
 	// +---------+
 	// | OpMinus | no operands
@@ -137,15 +166,110 @@ var definitions = map[Opcode]*Definition{
 	// | OpIndex | no operands
 	// +---------+
 
-	OpCall: {"OpCall", []int{}}, // call a function
-	// +--------+
-	// | OpCall |
-	// +--------+
+	OpCall: {"OpCall", []int{1}}, // call a function
+	// +--------+-----------------------+
+	// | OpCall | 1 byte argument count |
+	// +--------+-----------------------+
 	OpReturnValue: {"OpReturnValue", []int{}}, // return a value
 	// +---------------+
 	// | OpReturnValue |
 	// +---------------+
 	OpReturn: {"OpReturn", []int{}}, // return Null
+
+	OpClosure: {"OpClosure", []int{2, 1}}, // wrap a CompiledFunction constant into a Closure
+	// +-----------+------------------------+-------------------------+
+	// | OpClosure | 2 byte constant index  | 1 byte free var count   |
+	// +-----------+------------------------+-------------------------+
+	OpGetFree: {"OpGetFree", []int{1}},
+	// +-----------+-------------------------+
+	// | OpGetFree | 1 byte free var index   |
+	// +-----------+-------------------------+
+	OpSetFree: {"OpSetFree", []int{1}}, // assign a free variable, the closures sharing it see the value
+	// +-----------+-------------------------+
+	// | OpSetFree | 1 byte free var index   |
+	// +-----------+-------------------------+
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}}, // push the cell of a local for OpClosure
+	// +----------------+-------------------------+
+	// | OpCaptureLocal | 1 byte local index      |
+	// +----------------+-------------------------+
+	// the local moves into a cell the first time it's captured, the function
+	// and its closures all read and assign it through that cell
+	OpCaptureFree: {"OpCaptureFree", []int{1}}, // push the cell of a free variable for OpClosure
+	// +---------------+-------------------------+
+	// | OpCaptureFree | 1 byte free var index   |
+	// +---------------+-------------------------+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	// +--------------+------------------------------------+
+	// | OpGetBuiltin | 1 byte index into object.Builtins  |
+	// +--------------+------------------------------------+
+	OpCurrentClosure: {"OpCurrentClosure", []int{}}, // push the closure of the current frame
+	// +------------------+
+	// | OpCurrentClosure | no operands
+	// +------------------+
+	OpThrow: {"OpThrow", []int{}}, // raise the value on top of the stack as an error
+	// +---------+
+	// | OpThrow |
+	// +---------+
+	// the handler table of the function decides where the error is caught
+	OpIter: {"OpIter", []int{}}, // replace the value on top of the stack with an iterator over it
+	// +--------+
+	// | OpIter |
+	// +--------+
+	OpIterNext: {"OpIterNext", []int{2}}, // push the next element of the iterator on top of the stack
+	// +------------+--------------------+
+	// | OpIterNext | 2 byte jump offset |
+	// +------------+--------------------+
+	// once the iterator is done it is popped and the vm jumps to the offset
+	OpSetIndex: {"OpSetIndex", []int{}}, // set an element of an array or hash, leaves the value on the stack
+	// +------------+
+	// | OpSetIndex | no operands
+	// +------------+
+	// the stack holds the array or hash, the index and the value
+	OpDup: {"OpDup", []int{1}}, // push copies of the values on top of the stack
+	// +-------+----------------------------+
+	// | OpDup | 1 byte number of values    |
+	// +-------+----------------------------+
+	OpMod:        {"OpMod", []int{}},
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+	// +-------+
+	// | OpMod | no operands, like OpAdd
+	// +-------+
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	// +----------------+
+	// | OpGreaterEqual | no operands, compares 2 topmost from stack
+	// +----------------+
+	OpLessEqual: {"OpLessEqual", []int{}},
+	// +-------------+
+	// | OpLessEqual | no operands, compares 2 topmost from stack
+	// +-------------+
+	OpJumpIfFalsyOrPop: {"OpJumpIfFalsyOrPop", []int{2}}, // &&
+	// +--------------------+--------------------+
+	// | OpJumpIfFalsyOrPop | 2 byte jump offset |
+	// +--------------------+--------------------+
+	// jumps and keeps the value on top of the stack if it is falsy, pops it otherwise
+	OpJumpIfTruthyOrPop: {"OpJumpIfTruthyOrPop", []int{2}}, // ||
+	// +---------------------+--------------------+
+	// | OpJumpIfTruthyOrPop | 2 byte jump offset |
+	// +---------------------+--------------------+
+	OpInterpolate: {"OpInterpolate", []int{2}}, // join the Inspect of the values into a string
+	// +---------------+---------------------+
+	// | OpInterpolate | N (number of parts) |
+	// +---------------+---------------------+
+	OpSlice: {"OpSlice", []int{}}, // slice an array or string
+	// +---------+
+	// | OpSlice | no operands
+	// +---------+
+	// the stack holds the array or string, the start and the end, a bound
+	// that was left out is null
+	OpModule: {"OpModule", []int{2, 2}}, // build the namespace of an import
+	// +----------+---------------------------+-------------------------+
+	// | OpModule | Constant Index (its name) | N (number of exports)   |
+	// +----------+---------------------------+-------------------------+
+	// the stack holds the name and the value of each export like for OpHash
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -198,20 +322,12 @@ func Make(op Opcode, operands ...int) []byte { // (opcode, int offset (location)
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 
-	i := 0
-	for i < len(ins) {
-		def, err := Lookup(ins[i])
-		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+	for _, in := range decode(ins) {
+		if in.err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", in.err)
 			continue
 		}
-
-		operands, read := ReadOperands(def, ins[i+1:])
-
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
-
-		i += 1 + read
-
+		fmt.Fprintf(&out, "%04d %s\n", in.pos, ins.fmtInstruction(in.def, in.operands))
 	}
 	return out.String()
 }
@@ -226,14 +342,11 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		)
 	}
 
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	out := def.Name
+	for _, o := range operands {
+		out += fmt.Sprintf(" %d", o)
 	}
-
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return out
 }
 
 // ReadOperands Decode
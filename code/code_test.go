@@ -14,6 +14,10 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpSetLocal, []int{255}, []byte{byte(OpSetLocal), 255}},
+		{OpCall, []int{3}, []byte{byte(OpCall), 3}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpDup, []int{2}, []byte{byte(OpDup), 2}},
+		{OpInterpolate, []int{3}, []byte{byte(OpInterpolate), 0, 3}},
 	}
 
 	for _, tt := range tests {
@@ -44,12 +48,14 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpGetLocal, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpAdd
 0001 OpGetLocal 1
 0003 OpConstant 2
 0006 OpConstant 65535
+0009 OpClosure 65535 255
 `
 
 	concatted := Instructions{}
@@ -73,6 +79,8 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+		{OpGetBuiltin, []int{255}, 1},
 	}
 
 	for _, tt := range tests {
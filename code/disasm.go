@@ -0,0 +1,245 @@
+package code
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Constant is an entry of the constant pool as Disassemble lists it
+type Constant struct {
+	Type  string // object type, e.g. INTEGER
+	Value string // printed value, empty for functions
+
+	// only set for compiled functions
+	Instructions  Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string // name of the let binding, empty for anonymous functions
+	Handlers      HandlerTable
+}
+
+// Program is the bytecode Disassemble lists, see compiler.Bytecode.Disassemble
+type Program struct {
+	Instructions Instructions
+	Constants    []Constant
+	Handlers     HandlerTable // try blocks of the main instructions
+	Globals      []string     // names of the global slots, may be empty
+	Builtins     []string     // names of the builtin functions by index
+}
+
+// Disassemble lists the constant pool, the main instructions and every
+// compiled function, in the order the functions are referenced from main.
+// Jump targets and catch blocks get labels, operands get annotated with what
+// they refer to. The try blocks follow the instructions they protect.
+func Disassemble(p Program) string {
+	var out bytes.Buffer
+
+	out.WriteString("constants:\n")
+	for i, c := range p.Constants {
+		if c.Instructions != nil {
+			fmt.Fprintf(&out, "%04d %s %s params=%d locals=%d\n",
+				i, c.Type, p.functionLabel(i), c.NumParameters, c.NumLocals)
+			continue
+		}
+		fmt.Fprintf(&out, "%04d %s %s\n", i, c.Type, c.Value)
+	}
+
+	out.WriteString("\nmain:\n")
+	p.disassemble(&out, p.Instructions, p.Handlers)
+
+	for _, idx := range p.functionOrder() {
+		fn := p.Constants[idx]
+		fmt.Fprintf(&out, "\n%s: params=%d locals=%d\n",
+			p.functionLabel(idx), fn.NumParameters, fn.NumLocals)
+		p.disassemble(&out, fn.Instructions, fn.Handlers)
+	}
+
+	return out.String()
+}
+
+// functionLabel names a function by its let binding, anonymous functions
+// are fnN after their constant index. A name that several functions share
+// gets the constant index too, e.g. add#3.
+func (p Program) functionLabel(constIdx int) string {
+	if !p.isFunction(constIdx) || p.Constants[constIdx].Name == "" {
+		return fmt.Sprintf("fn%d", constIdx)
+	}
+	name := p.Constants[constIdx].Name
+	for i, c := range p.Constants {
+		if i != constIdx && c.Instructions != nil && c.Name == name {
+			return fmt.Sprintf("%s#%d", name, constIdx)
+		}
+	}
+	return name
+}
+
+// functionOrder returns the constant indexes of all functions, depth first as
+// they are referenced by OpClosure, followed by the ones never referenced
+func (p Program) functionOrder() []int {
+	order := []int{}
+	listed := map[int]bool{}
+
+	var visit func(ins Instructions)
+	visit = func(ins Instructions) {
+		for _, in := range decode(ins) {
+			if in.op != OpClosure {
+				continue
+			}
+			idx := in.operands[0]
+			if listed[idx] || !p.isFunction(idx) {
+				continue
+			}
+			listed[idx] = true
+			order = append(order, idx)
+			visit(p.Constants[idx].Instructions)
+		}
+	}
+	visit(p.Instructions)
+
+	for idx := range p.Constants {
+		if p.isFunction(idx) && !listed[idx] {
+			listed[idx] = true
+			order = append(order, idx)
+			visit(p.Constants[idx].Instructions)
+		}
+	}
+	return order
+}
+
+func (p Program) isFunction(constIdx int) bool {
+	return constIdx >= 0 && constIdx < len(p.Constants) &&
+		p.Constants[constIdx].Instructions != nil
+}
+
+func (p Program) disassemble(out *bytes.Buffer, ins Instructions, handlers HandlerTable) {
+	decoded := decode(ins)
+
+	// label every jump target and catch block of this instruction stream,
+	// in address order
+	addresses := []int{}
+	labels := map[int]string{}
+	addLabel := func(addr int) {
+		if _, ok := labels[addr]; !ok {
+			labels[addr] = ""
+			addresses = append(addresses, addr)
+		}
+	}
+	for _, in := range decoded {
+		if isJump(in.op) {
+			addLabel(in.operands[0])
+		}
+	}
+	for _, h := range handlers {
+		addLabel(h.Target)
+	}
+	sort.Ints(addresses)
+	for i, addr := range addresses {
+		labels[addr] = fmt.Sprintf("L%d", i)
+	}
+
+	for _, in := range decoded {
+		if label, ok := labels[in.pos]; ok {
+			fmt.Fprintf(out, "%s:\n", label)
+		}
+		if in.err != nil {
+			fmt.Fprintf(out, "%04d ERROR: %s\n", in.pos, in.err)
+			continue
+		}
+
+		line := fmt.Sprintf("%04d %s", in.pos, ins.fmtInstruction(in.def, in.operands))
+		if note := p.annotate(in, labels); note != "" {
+			line = fmt.Sprintf("%-28s ; %s", line, note)
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	// a jump past the last instruction, e.g. at the end of an if
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(out, "%s:\n", label)
+	}
+
+	// the errors raised in [start, end) continue at the catch block with
+	// depth values above the locals, inner try blocks first
+	for _, h := range handlers {
+		fmt.Fprintf(out, "try %04d-%04d catch %s depth=%d\n", h.Start, h.End, labels[h.Target], h.Depth)
+	}
+}
+
+// isJump reports whether the operand of op is a jump target
+func isJump(op Opcode) bool {
+	switch op {
+	case OpJump, OpJumpNotTruthy, OpIterNext, OpJumpIfFalsyOrPop, OpJumpIfTruthyOrPop:
+		return true
+	}
+	return false
+}
+
+// annotate describes what the operands of in refer to
+func (p Program) annotate(in instruction, labels map[int]string) string {
+	if isJump(in.op) {
+		return labels[in.operands[0]]
+	}
+
+	switch in.op {
+	case OpConstant:
+		idx := in.operands[0]
+		if idx >= len(p.Constants) {
+			return "constant out of range"
+		}
+		if p.isFunction(idx) {
+			return p.functionLabel(idx)
+		}
+		return p.Constants[idx].Value
+	case OpGetGlobal, OpSetGlobal:
+		if idx := in.operands[0]; idx < len(p.Globals) {
+			return p.Globals[idx]
+		}
+	case OpGetBuiltin:
+		if idx := in.operands[0]; idx < len(p.Builtins) {
+			return p.Builtins[idx]
+		}
+	case OpClosure:
+		return p.functionLabel(in.operands[0])
+	}
+	return ""
+}
+
+type instruction struct {
+	pos      int
+	op       Opcode
+	def      *Definition
+	operands []int
+	err      error
+}
+
+// decode splits ins into instructions, an undefined opcode is skipped by one
+// byte and truncated operands end the stream
+func decode(ins Instructions) []instruction {
+	decoded := []instruction{}
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			decoded = append(decoded, instruction{pos: i, op: Opcode(ins[i]), err: err})
+			i++
+			continue
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			err := fmt.Errorf("operands of %s truncated", def.Name)
+			decoded = append(decoded, instruction{pos: i, op: Opcode(ins[i]), err: err})
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, instruction{pos: i, op: Opcode(ins[i]), def: def, operands: operands})
+		i += 1 + read
+	}
+	return decoded
+}
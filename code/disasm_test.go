@@ -0,0 +1,188 @@
+package code
+
+import "testing"
+
+func concat(instructions ...[]byte) Instructions {
+	out := Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestDisassemble(t *testing.T) {
+	inner := concat(
+		Make(OpGetFree, 0),
+		Make(OpGetBuiltin, 0),
+		Make(OpCall, 1),
+		Make(OpReturnValue),
+	)
+	outer := concat(
+		Make(OpGetLocal, 0),
+		Make(OpClosure, 1, 1),
+		Make(OpReturnValue),
+	)
+
+	program := Program{
+		Instructions: concat(
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 14),
+			Make(OpClosure, 2, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpJump, 17),
+			Make(OpConstant, 0),
+			Make(OpPop),
+		),
+		Constants: []Constant{
+			{Type: "STRING", Value: `"monkey"`},
+			{Type: "COMPILED_FUNCTION_OBJ", Instructions: inner},
+			{Type: "COMPILED_FUNCTION_OBJ", Instructions: outer, NumLocals: 1, NumParameters: 1, Name: "f"},
+		},
+		Globals:  []string{"f"},
+		Builtins: []string{"len"},
+	}
+
+	expected := `constants:
+0000 STRING "monkey"
+0001 COMPILED_FUNCTION_OBJ fn1 params=0 locals=0
+0002 COMPILED_FUNCTION_OBJ f params=1 locals=1
+
+main:
+0000 OpTrue
+0001 OpJumpNotTruthy 14      ; L0
+0004 OpClosure 2 0           ; f
+0008 OpSetGlobal 0           ; f
+0011 OpJump 17               ; L1
+L0:
+0014 OpConstant 0            ; "monkey"
+L1:
+0017 OpPop
+
+f: params=1 locals=1
+0000 OpGetLocal 0
+0002 OpClosure 1 1           ; fn1
+0006 OpReturnValue
+
+fn1: params=0 locals=0
+0000 OpGetFree 0
+0002 OpGetBuiltin 0          ; len
+0004 OpCall 1
+0006 OpReturnValue
+`
+
+	if got := Disassemble(program); got != expected {
+		t.Errorf("code: wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestDisassembleJumpToEnd(t *testing.T) {
+	program := Program{
+		Instructions: concat(
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 4),
+		),
+	}
+
+	expected := `constants:
+
+main:
+0000 OpTrue
+0001 OpJumpNotTruthy 4       ; L0
+L0:
+`
+
+	if got := Disassemble(program); got != expected {
+		t.Errorf("code: wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	program := Program{
+		Instructions: Instructions{255, byte(OpAdd), byte(OpConstant), 0},
+	}
+
+	expected := `constants:
+
+main:
+0000 ERROR: opcode 255 undefined
+0001 OpAdd
+0002 ERROR: operands of OpConstant truncated
+`
+
+	if got := Disassemble(program); got != expected {
+		t.Errorf("code: wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+
+	// String used to loop forever on an undefined opcode
+	expectedString := "ERROR: opcode 255 undefined\n0001 OpAdd\nERROR: operands of OpConstant truncated\n"
+	if got := program.Instructions.String(); got != expectedString {
+		t.Errorf("code: instructions wrongly formated.\nwant=%q\ngot=%q", expectedString, got)
+	}
+}
+
+// functions that share a name get their constant index
+func TestDisassembleSharedNames(t *testing.T) {
+	fn := concat(Make(OpReturn))
+	program := Program{
+		Instructions: concat(
+			Make(OpClosure, 0, 0),
+			Make(OpClosure, 1, 0),
+		),
+		Constants: []Constant{
+			{Type: "COMPILED_FUNCTION_OBJ", Instructions: fn, Name: "f"},
+			{Type: "COMPILED_FUNCTION_OBJ", Instructions: fn, Name: "f"},
+		},
+	}
+
+	expected := `constants:
+0000 COMPILED_FUNCTION_OBJ f#0 params=0 locals=0
+0001 COMPILED_FUNCTION_OBJ f#1 params=0 locals=0
+
+main:
+0000 OpClosure 0 0           ; f#0
+0004 OpClosure 1 0           ; f#1
+
+f#0: params=0 locals=0
+0000 OpReturn
+
+f#1: params=0 locals=0
+0000 OpReturn
+`
+
+	if got := Disassemble(program); got != expected {
+		t.Errorf("code: wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestDisassembleHandlers(t *testing.T) {
+	program := Program{
+		Instructions: concat(
+			Make(OpGetGlobal, 0),
+			Make(OpCall, 0),
+			Make(OpJump, 10),
+			Make(OpPop),
+			Make(OpNull),
+			Make(OpPop),
+		),
+		Handlers: HandlerTable{{Start: 0, End: 5, Target: 8, Depth: 0}},
+		Globals:  []string{"f"},
+	}
+
+	expected := `constants:
+
+main:
+0000 OpGetGlobal 0           ; f
+0003 OpCall 0
+0005 OpJump 10               ; L1
+L0:
+0008 OpPop
+0009 OpNull
+L1:
+0010 OpPop
+try 0000-0005 catch L0 depth=0
+`
+
+	if got := Disassemble(program); got != expected {
+		t.Errorf("code: wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
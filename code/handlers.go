@@ -0,0 +1,25 @@
+package code
+
+// HandlerTable lists the try blocks of a function, inner blocks come first
+type HandlerTable []Handler
+
+// Handler catches the errors raised by the instructions in [Start, End).
+// The vm cuts the stack back to Depth values above the locals of the frame,
+// pushes the error and continues at Target, the start of the catch block
+type Handler struct {
+	Start  int
+	End    int
+	Target int
+	Depth  int
+}
+
+// Lookup returns the innermost handler covering the instruction at offset,
+// offset may point into the operands of the instruction
+func (ht HandlerTable) Lookup(offset int) (Handler, bool) {
+	for _, h := range ht {
+		if h.Start <= offset && offset < h.End {
+			return h, true
+		}
+	}
+	return Handler{}, false
+}
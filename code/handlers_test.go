@@ -0,0 +1,31 @@
+package code
+
+import "testing"
+
+func TestHandlerTableLookup(t *testing.T) {
+	handlers := HandlerTable{
+		{Start: 3, End: 6, Target: 9, Depth: 1},
+		{Start: 0, End: 16, Target: 19, Depth: 0},
+	}
+
+	tests := []struct {
+		offset   int
+		expected Handler
+		ok       bool
+	}{
+		{0, handlers[1], true},
+		{3, handlers[0], true},
+		{5, handlers[0], true},
+		{6, handlers[1], true},
+		{16, Handler{}, false},
+		{20, Handler{}, false},
+	}
+
+	for _, tt := range tests {
+		h, ok := handlers.Lookup(tt.offset)
+		if ok != tt.ok || h != tt.expected {
+			t.Errorf("wrong handler for offset %d. want=%+v (%t), got=%+v (%t)",
+				tt.offset, tt.expected, tt.ok, h, ok)
+		}
+	}
+}
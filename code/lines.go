@@ -0,0 +1,26 @@
+package code
+
+import (
+	"monkey/token"
+	"sort"
+)
+
+// LineTable maps instruction offsets to source positions, sorted by offset.
+// An entry covers its instruction and all following ones up to the next entry
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup returns the source position of the instruction at offset,
+// offset may point into the operands of the instruction
+func (lt LineTable) Lookup(offset int) (token.Position, bool) {
+	// first entry past offset, the one before covers offset
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}, false
+	}
+	return lt[i-1].Pos, true
+}
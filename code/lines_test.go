@@ -0,0 +1,36 @@
+package code
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestLineTableLookup(t *testing.T) {
+	lines := LineTable{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 3, Pos: token.Position{Line: 2, Column: 5}},
+		{Offset: 7, Pos: token.Position{Line: 1, Column: 3}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+		ok       bool
+	}{
+		{-1, token.Position{}, false},
+		{0, token.Position{Line: 1, Column: 1}, true},
+		{2, token.Position{Line: 1, Column: 1}, true},
+		{3, token.Position{Line: 2, Column: 5}, true},
+		{6, token.Position{Line: 2, Column: 5}, true},
+		{7, token.Position{Line: 1, Column: 3}, true},
+		{100, token.Position{Line: 1, Column: 3}, true},
+	}
+
+	for _, tt := range tests {
+		pos, ok := lines.Lookup(tt.offset)
+		if ok != tt.ok || pos != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s (%t), got=%s (%t)",
+				tt.offset, tt.expected, tt.ok, pos, ok)
+		}
+	}
+}
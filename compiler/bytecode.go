@@ -0,0 +1,519 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+// Bytecode file format
+//
+//	+-------+---------+-------+--------------+-------+----------+-----------+---------+
+//	| magic | version | files | instructions | lines | handlers | constants | globals |
+//	+-------+---------+-------+--------------+-------+----------+-----------+---------+
+//
+//	magic        4 bytes "MNKY"
+//	version      2 bytes
+//	files        4 byte count, followed by the source file names as strings
+//	instructions 4 byte length, followed by the raw instructions
+//	lines        line table of the instructions
+//	handlers     handler table of the instructions
+//	constants    4 byte count, followed by the constants
+//	globals      4 byte count, followed by the names of the global slots as strings
+//
+// every constant starts with a 1 byte tag for its type:
+//
+//	constInteger          8 byte two's complement value
+//	constString           string
+//	constCompiledFunction 2 byte NumLocals, 1 byte NumParameters, name as string,
+//	                      instructions, lines and handlers as above, then the
+//	                      local and the free variable names as string lists
+//	constFloat            8 byte IEEE 754 bits
+//	constBigInt           1 byte sign, 1 if negative, and the big endian bytes
+//	                      of the absolute value as a string
+//
+// strings are a 4 byte length, followed by the utf-8 bytes. string lists
+// are a 4 byte count, followed by the strings.
+// line tables are a 4 byte count, followed by 4 byte offset, file index,
+// line and column of every entry. handler tables are a 4 byte count,
+// followed by 4 byte start, end, target and depth of every entry.
+// all numbers are big endian, like the operands in code.Instructions
+
+// BytecodeMagic marks the start of every bytecode file
+var BytecodeMagic = []byte("MNKY")
+
+// BytecodeVersion is increased whenever the format or the instruction set changes
+const BytecodeVersion uint16 = 15
+
+const (
+	constInteger byte = iota + 1
+	constString
+	constCompiledFunction
+	constFloat
+	constBigInt
+)
+
+var errTruncated = errors.New("bytecode: unexpected end of data")
+
+// MarshalBinary encodes the bytecode in the bytecode file format
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.Write(BytecodeMagic)
+	binary.Write(&buf, binary.BigEndian, BytecodeVersion)
+
+	files := b.sourceFiles()
+	binary.Write(&buf, binary.BigEndian, uint32(len(files)))
+	for _, name := range files {
+		writeString(&buf, name)
+	}
+	fileIndex := map[string]int{}
+	for i, name := range files {
+		fileIndex[name] = i
+	}
+
+	writeInstructions(&buf, b.Instructions)
+	writeLines(&buf, b.Lines, fileIndex)
+	writeHandlers(&buf, b.Handlers)
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(b.Constants)))
+	for i, c := range b.Constants {
+		err := writeConstant(&buf, c, fileIndex)
+		if err != nil {
+			return nil, fmt.Errorf("bytecode: constant %d: %s", i, err)
+		}
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(b.Globals)))
+	for _, name := range b.Globals {
+		writeString(&buf, name)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes data written by MarshalBinary into b
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, len(BytecodeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, BytecodeMagic) {
+		return errors.New("bytecode: not a monkey bytecode file")
+	}
+
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return errTruncated
+	}
+	if version != BytecodeVersion {
+		return fmt.Errorf("bytecode: unsupported version %d, want %d", version, BytecodeVersion)
+	}
+
+	var numFiles uint32
+	if err := binary.Read(r, binary.BigEndian, &numFiles); err != nil {
+		return errTruncated
+	}
+
+	files := []string{}
+	for i := uint32(0); i < numFiles; i++ {
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+		files = append(files, name)
+	}
+
+	instructions, err := readInstructions(r)
+	if err != nil {
+		return err
+	}
+
+	lines, err := readLines(r, files)
+	if err != nil {
+		return err
+	}
+
+	handlers, err := readHandlers(r)
+	if err != nil {
+		return err
+	}
+
+	var numConstants uint32
+	if err := binary.Read(r, binary.BigEndian, &numConstants); err != nil {
+		return errTruncated
+	}
+
+	constants := []object.Object{}
+	for i := uint32(0); i < numConstants; i++ {
+		c, err := readConstant(r, files)
+		if err != nil {
+			return err
+		}
+		constants = append(constants, c)
+	}
+
+	var numGlobals uint32
+	if err := binary.Read(r, binary.BigEndian, &numGlobals); err != nil {
+		return errTruncated
+	}
+
+	globals := []string{}
+	for i := uint32(0); i < numGlobals; i++ {
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+		globals = append(globals, name)
+	}
+
+	if r.Len() != 0 {
+		return fmt.Errorf("bytecode: %d unexpected bytes after the globals", r.Len())
+	}
+
+	b.Instructions = instructions
+	b.Lines = lines
+	b.Handlers = handlers
+	b.Constants = constants
+	b.Globals = globals
+	return nil
+}
+
+func writeInstructions(buf *bytes.Buffer, ins code.Instructions) {
+	binary.Write(buf, binary.BigEndian, uint32(len(ins)))
+	buf.Write(ins)
+}
+
+func readInstructions(r *bytes.Reader) (code.Instructions, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, errTruncated
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, errTruncated
+	}
+
+	ins := make(code.Instructions, length)
+	if _, err := io.ReadFull(r, ins); err != nil {
+		return nil, errTruncated
+	}
+	return ins, nil
+}
+
+// sourceFiles returns the file names used by the line tables
+func (b *Bytecode) sourceFiles() []string {
+	files := []string{}
+	seen := map[string]bool{}
+
+	add := func(lines code.LineTable) {
+		for _, entry := range lines {
+			if !seen[entry.Pos.File] {
+				seen[entry.Pos.File] = true
+				files = append(files, entry.Pos.File)
+			}
+		}
+	}
+
+	add(b.Lines)
+	for _, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			add(fn.Lines)
+		}
+	}
+	return files
+}
+
+func writeLines(buf *bytes.Buffer, lines code.LineTable, fileIndex map[string]int) {
+	binary.Write(buf, binary.BigEndian, uint32(len(lines)))
+	for _, entry := range lines {
+		binary.Write(buf, binary.BigEndian, []uint32{
+			uint32(entry.Offset),
+			uint32(fileIndex[entry.Pos.File]),
+			uint32(entry.Pos.Line),
+			uint32(entry.Pos.Column),
+		})
+	}
+}
+
+func readLines(r *bytes.Reader, files []string) (code.LineTable, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, errTruncated
+	}
+	if int64(count)*16 > int64(r.Len()) {
+		return nil, errTruncated
+	}
+
+	var lines code.LineTable
+	for i := uint32(0); i < count; i++ {
+		entry := make([]uint32, 4)
+		if err := binary.Read(r, binary.BigEndian, entry); err != nil {
+			return nil, errTruncated
+		}
+		if int(entry[1]) >= len(files) {
+			return nil, fmt.Errorf("bytecode: unknown file index %d", entry[1])
+		}
+
+		lines = append(lines, code.LineEntry{
+			Offset: int(entry[0]),
+			Pos: token.Position{
+				File:   files[entry[1]],
+				Line:   int(entry[2]),
+				Column: int(entry[3]),
+			},
+		})
+	}
+	return lines, nil
+}
+
+func writeHandlers(buf *bytes.Buffer, handlers code.HandlerTable) {
+	binary.Write(buf, binary.BigEndian, uint32(len(handlers)))
+	for _, h := range handlers {
+		binary.Write(buf, binary.BigEndian, []uint32{
+			uint32(h.Start),
+			uint32(h.End),
+			uint32(h.Target),
+			uint32(h.Depth),
+		})
+	}
+}
+
+func readHandlers(r *bytes.Reader) (code.HandlerTable, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, errTruncated
+	}
+	if int64(count)*16 > int64(r.Len()) {
+		return nil, errTruncated
+	}
+
+	var handlers code.HandlerTable
+	for i := uint32(0); i < count; i++ {
+		entry := make([]uint32, 4)
+		if err := binary.Read(r, binary.BigEndian, entry); err != nil {
+			return nil, errTruncated
+		}
+		handlers = append(handlers, code.Handler{
+			Start:  int(entry[0]),
+			End:    int(entry[1]),
+			Target: int(entry[2]),
+			Depth:  int(entry[3]),
+		})
+	}
+	return handlers, nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", errTruncated
+	}
+	if int64(length) > int64(r.Len()) {
+		return "", errTruncated
+	}
+
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", errTruncated
+	}
+	return string(s), nil
+}
+
+func writeStrings(buf *bytes.Buffer, list []string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(list)))
+	for _, s := range list {
+		writeString(buf, s)
+	}
+}
+
+func readStrings(r *bytes.Reader) ([]string, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, errTruncated
+	}
+	list := []string{}
+	for i := uint32(0); i < count; i++ {
+		s, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+func writeConstant(buf *bytes.Buffer, obj object.Object, fileIndex map[string]int) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		buf.WriteByte(constInteger)
+		binary.Write(buf, binary.BigEndian, obj.Value)
+
+	case *object.Float:
+		buf.WriteByte(constFloat)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(obj.Value))
+
+	case *object.BigInt:
+		buf.WriteByte(constBigInt)
+		if obj.Value.Sign() < 0 {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		writeString(buf, string(obj.Value.Bytes()))
+
+	case *object.String:
+		buf.WriteByte(constString)
+		writeString(buf, obj.Value)
+
+	case *object.CompiledFunction:
+		buf.WriteByte(constCompiledFunction)
+		binary.Write(buf, binary.BigEndian, uint16(obj.NumLocals))
+		buf.WriteByte(byte(obj.NumParameters))
+		writeString(buf, obj.Name)
+		writeInstructions(buf, obj.Instructions)
+		writeLines(buf, obj.Lines, fileIndex)
+		writeHandlers(buf, obj.Handlers)
+		writeStrings(buf, obj.LocalNames)
+		writeStrings(buf, obj.FreeNames)
+
+	default:
+		return fmt.Errorf("unsupported constant type %s", obj.Type())
+	}
+	return nil
+}
+
+func readConstant(r *bytes.Reader, files []string) (object.Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, errTruncated
+	}
+
+	switch tag {
+	case constInteger:
+		var value int64
+		if err := binary.Read(r, binary.BigEndian, &value); err != nil {
+			return nil, errTruncated
+		}
+		return &object.Integer{Value: value}, nil
+
+	case constFloat:
+		var bits uint64
+		if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+			return nil, errTruncated
+		}
+		return &object.Float{Value: math.Float64frombits(bits)}, nil
+
+	case constBigInt:
+		sign, err := r.ReadByte()
+		if err != nil {
+			return nil, errTruncated
+		}
+		magnitude, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		value := new(big.Int).SetBytes([]byte(magnitude))
+		if sign == 1 {
+			value.Neg(value)
+		}
+		return object.NewInteger(value), nil
+
+	case constString:
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: value}, nil
+
+	case constCompiledFunction:
+		var numLocals uint16
+		if err := binary.Read(r, binary.BigEndian, &numLocals); err != nil {
+			return nil, errTruncated
+		}
+		numParameters, err := r.ReadByte()
+		if err != nil {
+			return nil, errTruncated
+		}
+		name, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := readInstructions(r)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := readLines(r, files)
+		if err != nil {
+			return nil, err
+		}
+		handlers, err := readHandlers(r)
+		if err != nil {
+			return nil, err
+		}
+		localNames, err := readStrings(r)
+		if err != nil {
+			return nil, err
+		}
+		freeNames, err := readStrings(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     int(numLocals),
+			NumParameters: int(numParameters),
+			Name:          name,
+			Lines:         lines,
+			Handlers:      handlers,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("bytecode: unknown constant tag %d", tag)
+	}
+}
+
+// Disassemble lists the bytecode in a human readable form, see code.Disassemble
+func (b *Bytecode) Disassemble() string {
+	program := code.Program{
+		Instructions: b.Instructions,
+		Handlers:     b.Handlers,
+		Globals:      b.Globals,
+	}
+
+	for _, v := range object.Builtins {
+		program.Builtins = append(program.Builtins, v.Name)
+	}
+
+	for _, c := range b.Constants {
+		constant := code.Constant{Type: string(c.Type())}
+
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			constant.Instructions = c.Instructions
+			constant.NumLocals = c.NumLocals
+			constant.NumParameters = c.NumParameters
+			constant.Name = c.Name
+			constant.Handlers = c.Handlers
+		case *object.String:
+			constant.Value = fmt.Sprintf("%q", c.Value)
+		default:
+			constant.Value = c.Inspect()
+		}
+		program.Constants = append(program.Constants, constant)
+	}
+
+	return code.Disassemble(program)
+}
@@ -0,0 +1,174 @@
+package compiler
+
+import (
+	"bytes"
+	"math/big"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		`1 + 2; -9223372036854775807`,
+		`9223372036854775808; 99999999999999999999`,
+		`1.5 * 2; -2.5e-3`,
+		`"monkey" + ""`,
+		`let add = fn(a, b) { let c = a + b; c }; add(1, 2)`,
+		`let newAdder = fn(a) { fn(b) { a + b } }; newAdder(1)(2)`,
+		`[1, 2, 3][0]; {"one": 1}["one"]; len("four")`,
+		`let f = fn() { try { throw "x" } catch (e) { e } }; try { f() } catch (e) { 1 }`,
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.NewWithFile("test.mk", input)).ParseProgram()
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+
+		data, err := bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %s", err)
+		}
+
+		decoded := &Bytecode{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary failed: %s", err)
+		}
+
+		testBytecodeEqual(t, bytecode, decoded)
+	}
+}
+
+func TestBytecodeBigIntConstant(t *testing.T) {
+	value, _ := new(big.Int).SetString("-18446744073709551616", 10)
+	bytecode := &Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.BigInt{Value: value}},
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	decoded := &Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+
+	testBytecodeEqual(t, bytecode, decoded)
+}
+
+func TestBytecodeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.Boolean{Value: true}},
+	}
+
+	_, err := bytecode.MarshalBinary()
+	if err == nil {
+		t.Fatalf("expected an error for a BOOLEAN constant")
+	}
+}
+
+func TestBytecodeUnmarshalErrors(t *testing.T) {
+	valid, err := (&Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.String{Value: "monkey"}},
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte{}, "not a monkey bytecode file"},
+		{[]byte("ELF\x00\x00\x01"), "not a monkey bytecode file"},
+		{append([]byte("MNKY"), 0xff, 0xff), "unsupported version 65535"},
+		{valid[:len(valid)-1], "unexpected end of data"},
+		{valid[:len(valid)-7], "unexpected end of data"},
+		{valid[:len(valid)-11], "unexpected end of data"},
+		{append(append([]byte{}, valid...), 0), "unexpected bytes after the globals"},
+		{bytes.Replace(append([]byte{}, valid...), []byte{constString, 0, 0, 0, 6}, []byte{0x7f, 0, 0, 0, 6}, 1),
+			"unknown constant tag 127"},
+	}
+
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.data, tt.expected, err)
+		}
+	}
+}
+
+func testBytecodeEqual(t *testing.T, expected, actual *Bytecode) {
+	t.Helper()
+
+	if err := testInstructions([]code.Instructions{expected.Instructions}, actual.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(actual.Lines, expected.Lines) {
+		t.Fatalf("wrong lines. want=%v, got=%v", expected.Lines, actual.Lines)
+	}
+
+	if !reflect.DeepEqual(actual.Handlers, expected.Handlers) {
+		t.Fatalf("wrong handlers. want=%v, got=%v", expected.Handlers, actual.Handlers)
+	}
+
+	if strings.Join(actual.Globals, ",") != strings.Join(expected.Globals, ",") {
+		t.Fatalf("wrong globals. want=%q, got=%q", expected.Globals, actual.Globals)
+	}
+
+	if len(actual.Constants) != len(expected.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(expected.Constants), len(actual.Constants))
+	}
+
+	for i, want := range expected.Constants {
+		got := actual.Constants[i]
+		if got.Type() != want.Type() {
+			t.Fatalf("constant %d - wrong type. want=%s, got=%s", i, want.Type(), got.Type())
+		}
+
+		switch want := want.(type) {
+		case *object.CompiledFunction:
+			fn := got.(*object.CompiledFunction)
+			if !reflect.DeepEqual(fn.Handlers, want.Handlers) {
+				t.Errorf("constant %d - wrong handlers. want=%v, got=%v", i, want.Handlers, fn.Handlers)
+			}
+			if fn.Name != want.Name || !reflect.DeepEqual(fn.Lines, want.Lines) {
+				t.Errorf("constant %d - wrong name or lines. want=%q %v, got=%q %v",
+					i, want.Name, want.Lines, fn.Name, fn.Lines)
+			}
+			if strings.Join(fn.LocalNames, ",") != strings.Join(want.LocalNames, ",") ||
+				strings.Join(fn.FreeNames, ",") != strings.Join(want.FreeNames, ",") {
+				t.Errorf("constant %d - wrong variable names. want=%q %q, got=%q %q",
+					i, want.LocalNames, want.FreeNames, fn.LocalNames, fn.FreeNames)
+			}
+			if fn.NumLocals != want.NumLocals || fn.NumParameters != want.NumParameters {
+				t.Errorf("constant %d - wrong locals/parameters. want=%d/%d, got=%d/%d",
+					i, want.NumLocals, want.NumParameters, fn.NumLocals, fn.NumParameters)
+			}
+			if err := testInstructions([]code.Instructions{want.Instructions}, fn.Instructions); err != nil {
+				t.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		default:
+			if got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d - wrong value. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+			}
+		}
+	}
+}
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/module"
 	"monkey/object"
-	"sort"
+	"monkey/token"
 )
 
 type EmittedInstruction struct {
@@ -13,6 +14,11 @@ type EmittedInstruction struct {
 	Position int
 }
 
+// maxByteOperand is the largest 1 byte operand. Locals, free variables,
+// parameters and arguments are counted by 1 byte operands and
+// CompiledFunction.NumParameters is 1 byte in the bytecode file.
+const maxByteOperand = 255
+
 // generate instructions and constants
 type Compiler struct {
 	// instructions code.Instructions | remove for CompilationScope
@@ -25,11 +31,24 @@ type Compiler struct {
 	// stack of compilation scopes
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// let-bound functions that were defined ahead of their let statement
+	hoisted map[*ast.LetStatement]Symbol
+
+	// source position of the node being compiled, recorded in the line tables
+	pos token.Position
+
+	// finds the modules of imports, the compiled modules are kept in the
+	// global symbol table
+	loader *module.Loader
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Globals      []string       // names of the global slots, for the disassembler
+	Lines        code.LineTable // source positions of the main instructions
+	Handlers     code.HandlerTable
 }
 
 // before compiling a new scope e.g. a function body, we push a new CompilationScope on to the scopes stack
@@ -38,6 +57,21 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	lines    code.LineTable    // source positions of the instructions
+	handlers code.HandlerTable // try blocks of the scope
+	depth    int               // number of values on the stack above the locals
+	loops    []*loop           // loops around the code being compiled, innermost last
+
+	unassigned map[Symbol]bool // hoisted functions whose let statement wasn't compiled yet
+}
+
+// loop is a while or for loop being compiled
+type loop struct {
+	start     int   // where continue jumps to, the condition or the OpIterNext
+	depth     int   // stack depth at start, continue drops the values above it
+	exitDepth int   // stack depth after the loop, break drops the values above it
+	breaks    []int // jumps of the break statements, patched with the end of the loop
 }
 
 // init compiler reference
@@ -46,18 +80,33 @@ func New() *Compiler {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		unassigned:          map[Symbol]bool{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
 	}
 
 	return &Compiler{
 		constants: []object.Object{},
 		// track last Instruction that should be kept on stack
-		symbolTable: NewSymbolTable(),
+		symbolTable: symbolTable,
 
 		scopes:     []CompilationScope{mainScope},
 		scopeIndex: 0,
+
+		hoisted: map[*ast.LetStatement]Symbol{},
+
+		loader: module.NewLoader(nil),
 	}
 }
 
+// SetLoader sets the loader imports are compiled with, e.g. for a search path
+func (c *Compiler) SetLoader(loader *module.Loader) {
+	c.loader = loader
+}
+
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
@@ -69,11 +118,25 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 // find *ast.Literals -> turn into *object.Objects -> add to constants
 //
 // returns an error if compilation failed
+// Compile compiles node, the emitted instructions are attributed to the
+// position of the innermost node that has one
 func (c *Compiler) Compile(node ast.Node) error {
+	outer := c.pos
+	if pos := node.Pos(); pos.IsValid() {
+		c.pos = pos
+	}
+
+	err := c.compile(node)
+	c.pos = outer
+	return err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
 	switch node := node.(type) {
 	// NOTE: start with all the program statements
 	// go through all statements and call Compile
 	case *ast.Program:
+		c.hoistFunctions(node.Statements)
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -81,6 +144,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+
+	case *ast.ExportStatement:
+		return c.Compile(node.Statement)
+
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -99,10 +168,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "-":
 			c.emit(code.OpMinus)
 		default:
-			return fmt.Errorf("compiler: unknown prefix operator %s", node.Operator)
+			return fmt.Errorf("compiler: %s: unknown prefix operator %s", node.Pos(), node.Operator)
 		}
 
 	case *ast.BlockStatement:
+		c.hoistFunctions(node.Statements)
 		for _, s := range node.Statements { // compiling all the statements
 			err := c.Compile(s)
 			if err != nil {
@@ -114,19 +184,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// +------+----------+-------+
 		// | left | Operator | right |
 		// +------+----------+-------+
-		if node.Operator == "<" {
-			// compile right
-			err := c.Compile(node.Right)
-			if err != nil {
-				return nil
-			}
-			// before left
-			err = c.Compile(node.Left)
-			if err != nil {
-				return nil
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 		// compile left
 		err := c.Compile(node.Left)
@@ -149,17 +208,40 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("compiler: unknown infix operator %s", node.Operator)
+			return fmt.Errorf("compiler: %s: unknown infix operator %s", node.Pos(), node.Operator)
 		}
 
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
 	case *ast.IfExpression:
+		depth := c.scopes[c.scopeIndex].depth
+
 		// compile the condition
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -196,12 +278,59 @@ func (c *Compiler) Compile(node ast.Node) error {
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos) // update the jump to after the alternative
 
+		// only one of the branches ran
+		c.scopes[c.scopeIndex].depth = depth + 1
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("compiler: %s: break outside of a loop", node.Pos())
+		}
+		depth := c.scopes[c.scopeIndex].depth
+		c.dropValues(l.exitDepth)
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+		// the rest of the block is unreachable, keep its depth as it was
+		c.scopes[c.scopeIndex].depth = depth
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("compiler: %s: continue outside of a loop", node.Pos())
+		}
+		depth := c.scopes[c.scopeIndex].depth
+		c.dropValues(l.depth)
+		c.emit(code.OpJump, l.start)
+		c.scopes[c.scopeIndex].depth = depth
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
 	case *ast.IntegerLiteral:
 		// NOTE: literals are constant expressions and their value does not change
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
 		// we generate the OpConstant instruction with the constant identifier
 		c.emit(code.OpConstant, c.addConstant(integer))
 
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -210,27 +339,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
+		if symbol, ok := c.hoisted[node]; ok {
+			return c.compileHoistedLet(node, symbol)
+		}
+
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 		symbol := c.symbolTable.Define(node.Name.Value) // retuns (Name, Scope, Index)
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-		}
+		c.storeSymbol(symbol)
+		delete(c.scopes[c.scopeIndex].unassigned, symbol)
 
 	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
+		symbol, ok := c.resolve(node)
 		if !ok {
-			return fmt.Errorf("Compile(): undefined variable %s", node.Value) // "compile time error" !!
-		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpGetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpGetLocal, symbol.Index)
+			return fmt.Errorf("Compile(): %s: undefined variable %s", node.Pos(), node.Value) // "compile time error" !!
 		}
+		c.loadSymbol(symbol)
 
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
@@ -246,19 +372,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpArray, len(node.Elements))
 
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
 	case *ast.HashLiteral:
-		// define keys array as array of Expression objects - and append keys to the array
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		// sort all keys by their string representation
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		// go through each pair and compile keys and values
-		for i, k := range keys {
+		// go through each pair in source order and compile keys and values,
+		// the hash keeps that order
+		for i, k := range node.Keys {
 			// compile key
 			err := c.Compile(k)
 			if err != nil {
@@ -286,29 +411,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpIndex)
 
-	case *ast.FunctionLiteral:
-		c.enterScope()
-
-		err := c.Compile(node.Body)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
 		if err != nil {
-			return fmt.Errorf("comp: Compile(): (FunctionLiteral) compilation failed. %s", err)
+			return err
 		}
-
-		// if the last instruction is a pop, we want to implicitely return
-		if c.lastInstructionIs(code.OpPop) {
-			c.replaceLastPopWithReturn()
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			if err := c.Compile(bound); err != nil {
+				return err
+			}
 		}
+		c.emit(code.OpSlice)
 
-		// if the last instruction is not a return value, we expect to emit a default return -> we didnt' have any instructions
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+	case *ast.FunctionLiteral:
+		err := c.compileFunctionLiteral(node)
+		if err != nil {
+			return err
 		}
 
-		instructions := c.leaveScope()
-
-		compiledFn := &object.CompiledFunction{Instructions: instructions}
-		c.emit(code.OpConstant, c.addConstant(compiledFn))
-
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
@@ -323,16 +447,413 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("comp: Compile(): (CallExpression) compilation failed. %s", err)
 		}
 
-		c.emit(code.OpCall)
+		if len(node.Arguments) > maxByteOperand {
+			return fmt.Errorf("compiler: %s: too many arguments, %d is more than %d",
+				node.Pos(), len(node.Arguments), maxByteOperand)
+		}
+
+		// arguments are pushed on the stack right above the function
+		for i, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return fmt.Errorf("comp: Compile(): (CallExpression) argument %d compilation failed. %s", i, err)
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
 
 	}
 	return nil
 }
 
+// compileTryExpression compiles the try block as a protected range of the handler table.
+// When it fails the vm continues at the catch block, with the error on top of the stack
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	depth := c.scopes[c.scopeIndex].depth
+	start := len(c.currentInstructions())
+
+	err := c.Compile(node.Block)
+	if err != nil {
+		return err
+	}
+	c.keepBlockValue(start)
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.scopes[c.scopeIndex].handlers = append(c.scopes[c.scopeIndex].handlers, code.Handler{
+		Start:  start,
+		End:    jumpPos,
+		Target: len(c.currentInstructions()),
+		Depth:  depth,
+	})
+
+	// the error pushed by the vm
+	c.scopes[c.scopeIndex].depth = depth + 1
+	symbol := c.symbolTable.Define(node.Parameter.Value)
+	c.storeSymbol(symbol)
+
+	catchStart := len(c.currentInstructions())
+	err = c.Compile(node.Catch)
+	if err != nil {
+		return err
+	}
+	c.keepBlockValue(catchStart)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	c.scopes[c.scopeIndex].depth = depth + 1
+	return nil
+}
+
+// compileLogicalExpression only evaluates the right side of && and || when the
+// left side doesn't decide the result, the result is the last value evaluated
+//
+//	     <left>
+//	     OpJumpIfFalsyOrPop end   (OpJumpIfTruthyOrPop for ||)
+//	     <right>
+//	end:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	depth := c.scopes[c.scopeIndex].depth
+
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	var jumpPos int
+	if node.Operator == "&&" {
+		jumpPos = c.emit(code.OpJumpIfFalsyOrPop, 9999)
+	} else {
+		jumpPos = c.emit(code.OpJumpIfTruthyOrPop, 9999)
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	// either side is left on the stack
+	c.scopes[c.scopeIndex].depth = depth + 1
+	return nil
+}
+
+// compileAssignExpression stores the value in a variable or an element, and
+// leaves it on the stack as the value of the expression
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.resolve(target)
+		if !ok {
+			return fmt.Errorf("Compile(): %s: undefined variable %s", target.Pos(), target.Value)
+		}
+		// a free variable is a cell shared with the function that defines it,
+		// unless it's the name of that function
+		assignable := symbol.Scope == GlobalScope || symbol.Scope == LocalScope ||
+			symbol.Scope == FreeScope && c.symbolTable.origin(symbol).Scope != FunctionScope
+		if !assignable {
+			return fmt.Errorf("compiler: %s: cannot assign to %s", target.Pos(), target.Value)
+		}
+
+		if node.Operator != "=" {
+			c.loadSymbol(symbol)
+		}
+		err := c.compileAssignedValue(node)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			// keep the array and index for OpSetIndex
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+		err = c.compileAssignedValue(node)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("compiler: %s: cannot assign to %s", node.Pos(), node.Target.String())
+	}
+	return nil
+}
+
+// compileAssignedValue compiles the right side of an assignment, for += and -=
+// the current value of the target is on the stack already
+func (c *Compiler) compileAssignedValue(node *ast.AssignExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "=":
+	case "+=":
+		c.emit(code.OpAdd)
+	case "-=":
+		c.emit(code.OpSub)
+	default:
+		return fmt.Errorf("compiler: %s: unknown assignment operator %s", node.Pos(), node.Operator)
+	}
+	return nil
+}
+
+// compileWhileStatement checks the condition before every run of the body
+//
+//	start: <condition>
+//	       OpJumpNotTruthy end
+//	       <body>
+//	       OpJump start
+//	end:
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	depth := c.scopes[c.scopeIndex].depth
+	start := len(c.currentInstructions())
+
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+	exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	l, err := c.compileLoopBody(node.Body, start, depth, depth)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+	c.patchLoopExits(l, exitPos)
+	return nil
+}
+
+// compileForStatement keeps an iterator on the stack while the loop runs,
+// OpIterNext drops it once it is done
+//
+//	       <iterable>
+//	       OpIter
+//	start: OpIterNext end
+//	       <store the element in the variable>
+//	       <body>
+//	       OpJump start
+//	end:
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	depth := c.scopes[c.scopeIndex].depth
+
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	start := len(c.currentInstructions())
+	exitPos := c.emit(code.OpIterNext, 9999)
+	symbol := c.symbolTable.Define(node.Variable.Value)
+	c.storeSymbol(symbol)
+
+	l, err := c.compileLoopBody(node.Body, start, depth+1, depth)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+	c.patchLoopExits(l, exitPos)
+	return nil
+}
+
+// compileLoopBody compiles body with a new loop as the target of its
+// break and continue statements
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, start, depth, exitDepth int) (*loop, error) {
+	l := &loop{start: start, depth: depth, exitDepth: exitDepth}
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, l)
+
+	err := c.Compile(body)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	return l, err
+}
+
+// patchLoopExits points the jump at exitPos and the breaks of l to the end of the loop
+func (c *Compiler) patchLoopExits(l *loop, exitPos int) {
+	end := len(c.currentInstructions())
+	c.changeOperand(exitPos, end)
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+	c.scopes[c.scopeIndex].depth = l.exitDepth
+}
+
+// currentLoop returns the innermost loop of the current scope, nil outside of loops
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// dropValues pops the stack down to depth
+func (c *Compiler) dropValues(depth int) {
+	for c.scopes[c.scopeIndex].depth > depth {
+		c.emit(code.OpPop)
+	}
+}
+
+// keepBlockValue leaves the value of the block just compiled on the stack,
+// Null if the block didn't end in an expression. start is where the block begins
+// so a pop emitted before it is left alone
+func (c *Compiler) keepBlockValue(start int) {
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+// compileFunctionLiteral compiles the function in its own scope and emits the OpClosure
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	if len(node.Parameters) > maxByteOperand {
+		return fmt.Errorf("compiler: %s: too many parameters, %d is more than %d",
+			node.Pos(), len(node.Parameters), maxByteOperand)
+	}
+
+	c.enterScope()
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	// parameters are the first locals of the function scope
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return fmt.Errorf("comp: Compile(): (FunctionLiteral) compilation failed. %s", err)
+	}
+
+	// if the last instruction is a pop, we want to implicitely return
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+
+	// if the last instruction is not a return value, we expect to emit a default return -> we didnt' have any instructions
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.localNames()
+	lines := c.scopes[c.scopeIndex].lines
+	handlers := c.scopes[c.scopeIndex].handlers
+	instructions := c.leaveScope()
+
+	// the last local has the index numLocals-1
+	if numLocals-1 > maxByteOperand {
+		return fmt.Errorf("compiler: %s: too many local variables, %d is more than %d",
+			node.Pos(), numLocals, maxByteOperand+1)
+	}
+	if len(freeSymbols) > maxByteOperand {
+		return fmt.Errorf("compiler: %s: too many captured variables, %d is more than %d",
+			node.Pos(), len(freeSymbols), maxByteOperand)
+	}
+
+	// push the cells of the captured variables in the enclosing scope,
+	// OpClosure collects them
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Lines:         lines,
+		Handlers:      handlers,
+		LocalNames:    localNames,
+	}
+	for _, s := range freeSymbols {
+		compiledFn.FreeNames = append(compiledFn.FreeNames, s.Name)
+	}
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+// Recursion
+//
+// let-bound functions of a block are defined before any statement of the block is compiled,
+// so they can refer to themselves and to each other.
+// globals are looked up at runtime, so that is all they need.
+// locals are captured as cells, so a closure that captured a function which wasn't assigned
+// yet sees it once the function's let statement stored it in the cell.
+
+// resolve looks up the symbol of ident. A hoisted function can't be used
+// before its let statement ran, only the functions of the scope may refer to
+// it early, their bodies run later.
+func (c *Compiler) resolve(ident *ast.Identifier) (Symbol, bool) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok || c.scopes[c.scopeIndex].unassigned[symbol] {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+// hoistFunctions defines the names of all let-bound functions in stmts
+func (c *Compiler) hoistFunctions(stmts []ast.Statement) {
+	for _, s := range stmts {
+		if export, ok := s.(*ast.ExportStatement); ok {
+			s = export.Statement
+		}
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+
+		symbol := c.symbolTable.Define(let.Name.Value)
+		c.hoisted[let] = symbol
+		c.scopes[c.scopeIndex].unassigned[symbol] = true
+	}
+}
+
+// compileHoistedLet compiles a let-bound function into its already defined symbol
+func (c *Compiler) compileHoistedLet(node *ast.LetStatement, symbol Symbol) error {
+	delete(c.hoisted, node)
+
+	err := c.compileFunctionLiteral(node.Value.(*ast.FunctionLiteral))
+	if err != nil {
+		return err
+	}
+	c.storeSymbol(symbol)
+	delete(c.scopes[c.scopeIndex].unassigned, symbol)
+	return nil
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Globals:      c.symbolTable.globalNames(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Handlers:     c.scopes[c.scopeIndex].handlers,
 	}
 }
 
@@ -344,10 +865,62 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
+	c.addLine(pos)
+	c.scopes[c.scopeIndex].depth += stackEffect(op, operands)
 
 	return pos
 }
 
+// stackEffect is the number of values op pushes minus the number it pops.
+// The try blocks and loops restore the stack depth it tracks, so every
+// opcode must be listed, an unknown one panics.
+func stackEffect(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin,
+		code.OpCurrentClosure, code.OpIterNext, code.OpCaptureLocal, code.OpCaptureFree:
+		return 1
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+		code.OpLessThan, code.OpLessEqual,
+		code.OpJumpIfFalsyOrPop, code.OpJumpIfTruthyOrPop,
+		code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpSetFree,
+		code.OpIndex, code.OpReturnValue, code.OpThrow:
+		return -1
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return 1 - operands[0]
+	case code.OpModule:
+		return 1 - 2*operands[1]
+	case code.OpCall:
+		return -operands[0] // the function and its arguments for the result
+	case code.OpClosure:
+		return 1 - operands[1]
+	case code.OpSetIndex, code.OpSlice:
+		return -2
+	case code.OpDup:
+		return operands[0]
+	case code.OpMinus, code.OpBang, code.OpIter, code.OpJump, code.OpReturn:
+		return 0
+	}
+	panic(fmt.Sprintf("compiler: no stack effect for opcode %d", op))
+}
+
+// addLine records the current source position for the instruction at offset
+func (c *Compiler) addLine(offset int) {
+	lines := c.scopes[c.scopeIndex].lines
+
+	// drop the entries of removed instructions
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= offset {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 || lines[len(lines)-1].Pos != c.pos {
+		lines = append(lines, code.LineEntry{Offset: offset, Pos: c.pos})
+	}
+	c.scopes[c.scopeIndex].lines = lines
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -399,6 +972,7 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].depth++
 }
 
 func (c *Compiler) replaceLastPopWithReturn() {
@@ -425,6 +999,47 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 	c.replaceInstruction(opPos, newInstruction)
 }
 
+// storeSymbol emits the set instruction matching the scope of the symbol
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// loadSymbol emits the get instruction matching the scope of the symbol
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// captureSymbol pushes what a closure captures of s: the cell of a local
+// or free variable, the value of anything else
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
 // Scopes
 //
 // scope helper functions
@@ -438,6 +1053,7 @@ func (c *Compiler) enterScope() {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		unassigned:          map[Symbol]bool{},
 	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex += 1
@@ -5,8 +5,14 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -117,11 +123,31 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterEqual),
 				code.Make(code.OpPop),
 			},
 		},
@@ -179,6 +205,34 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a${1}b${true}"`,
+			expectedConstants: []interface{}{"a", 1, "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpTrue),
+				code.Make(code.OpInterpolate, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"${"x"}"`,
+			expectedConstants: []interface{}{"x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpInterpolate, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -292,6 +346,47 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1][1:2]",
+			expectedConstants: []interface{}{1, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"ab"[:1]`,
+			expectedConstants: []interface{}{"ab", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"ab"[1:]`,
+			expectedConstants: []interface{}{"ab", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -344,7 +439,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -362,7 +457,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -379,7 +474,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -391,7 +486,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -412,8 +507,8 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1), // the compiled function
-				code.Make(code.OpCall),
+				code.Make(code.OpClosure, 1, 0), // the compiled function wrapped in a closure
+				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -430,10 +525,60 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1), // the compiled function
+				code.Make(code.OpClosure, 1, 0), // the compiled function wrapped in a closure
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let oneArg = fn(a) {a};
+			oneArg(24);
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let manyArg = fn(a, b, c) {a; b; c};
+			manyArg(24, 25, 26);
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+				25,
+				26,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCall, 3),
 				code.Make(code.OpPop),
 			},
 		},
@@ -442,6 +587,203 @@ func TestFunctionCalls(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestCompilerErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;\n  b", "2:3: undefined variable b"},
+		{"fn(x) {\n\tx + y\n}", "2:6: undefined variable y"},
+		{"let a = 1;\nb = a", "2:1: undefined variable b"},
+		{"len = 1", "1:1: cannot assign to len"},
+		{"fn() { let f = fn() { fn() { f = 1 } }; f }", "1:30: cannot assign to f"},
+		// hoisted functions can't be used before their let statement
+		{"puts(f); let f = fn() { 1 };", "1:6: undefined variable f"},
+		{"let x = f + 1; let f = fn() { 1 };", "1:9: undefined variable f"},
+		{"let g = fn() { let y = h; let h = fn() { 1 }; y };", "1:24: undefined variable h"},
+		{"f = 1; let f = fn() { 1 };", "1:1: undefined variable f"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// every opcode needs a stack effect, the depth of try blocks and loops depends on it
+func TestStackEffects(t *testing.T) {
+	for op := 0; op < 256; op++ {
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			continue
+		}
+		operands := make([]int, len(def.OperandWidths))
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s: %v", def.Name, r)
+				}
+			}()
+			stackEffect(code.Opcode(op), operands)
+		}()
+	}
+}
+
+// the vm addresses locals, free variables, parameters and arguments with 1 byte operands
+func TestOperandLimits(t *testing.T) {
+	lets := func(names []string) string {
+		out := ""
+		for _, n := range names {
+			out += "let " + n + " = 1; "
+		}
+		return out
+	}
+	ones := strings.TrimSuffix(strings.Repeat("1, ", 300), ", ")
+
+	tests := []struct {
+		input    string
+		expected string // "" if it compiles
+	}{
+		{"fn() { " + lets(letterNames(256)) + "}", ""},
+		{"fn() { " + lets(letterNames(300)) + "}", "1:1: too many local variables, 300 is more than 256"},
+		{"fn(" + strings.Join(letterNames(255), ", ") + ") {}", ""},
+		{"fn(" + strings.Join(letterNames(300), ", ") + ") {}", "1:1: too many parameters, 300 is more than 255"},
+		{"puts(" + ones + ")", "1:5: too many arguments, 300 is more than 255"},
+		{"fn() { " + lets(letterNames(255)) + "fn() { " + strings.Join(letterNames(255), "; ") + " } }", ""},
+		{"fn() { " + lets(letterNames(256)) + "fn() { " + strings.Join(letterNames(256), "; ") + " } }",
+			"too many captured variables, 256 is more than 255"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error: %s", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// letterNames returns n distinct identifiers, identifiers can't have digits
+func letterNames(n int) []string {
+	names := []string{}
+	for i := 0; i < n; i++ {
+		name := ""
+		for j := i; ; j = j/26 - 1 {
+			name = string(rune('a'+j%26)) + name
+			if j < 26 {
+				break
+			}
+		}
+		names = append(names, "v"+name)
+	}
+	return names
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	modules := map[string]string{
+		"a.mk":         `import "b"`,
+		"b.mk":         `import "a"`,
+		"broken.mk":    "let x = 1;\nlet y 2;",
+		"undefined.mk": "export let f = fn() {\n  nope };",
+		"noexport.mk":  `export let x = 1; import "nothere"`,
+	}
+	for name, source := range modules {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write module: %s", err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "nothere"`, "1:1: module not found: nothere.mk"},
+		{"let x = 1;\nimport \"a\"", "b.mk:1:1: import cycle: a.mk -> b.mk -> a.mk"},
+		{`import "broken"`, "1:1: " + filepath.Join(dir, "broken.mk") + ":2:7: expected next token to be =, got INT instead"},
+		{`import "undefined"`, filepath.Join(dir, "undefined.mk") + ":2:3: undefined variable nope"},
+		{`import "noexport"`, "noexport.mk:1:19: module not found: nothere.mk"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		compiler.SetLoader(module.NewLoader([]string{dir}))
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	program := parse("1 +\n  2;\nlet f = fn(a) {\n  -a\n};")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	pos := func(line, column int) token.Position {
+		return token.Position{Line: line, Column: column}
+	}
+
+	expectedMain := code.LineTable{
+		{Offset: 0, Pos: pos(1, 1)}, // OpConstant 1
+		{Offset: 3, Pos: pos(2, 3)}, // OpConstant 2
+		{Offset: 6, Pos: pos(1, 3)}, // OpAdd
+		{Offset: 7, Pos: pos(1, 1)}, // OpPop
+		{Offset: 8, Pos: pos(3, 1)}, // OpClosure, OpSetGlobal of the hoisted let
+	}
+	testLineTable(t, "main", expectedMain, bytecode.Lines)
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 is not a function. got=%T", bytecode.Constants[2])
+	}
+	if fn.Name != "f" {
+		t.Errorf("wrong function name. want=%q, got=%q", "f", fn.Name)
+	}
+
+	expectedFn := code.LineTable{
+		{Offset: 0, Pos: pos(4, 4)}, // OpGetLocal
+		{Offset: 2, Pos: pos(4, 3)}, // OpMinus, OpReturnValue replaced the pop
+	}
+	testLineTable(t, "f", expectedFn, fn.Lines)
+}
+
+func testLineTable(t *testing.T, name string, expected, actual code.LineTable) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("%s: wrong line table length. want=%v, got=%v", name, expected, actual)
+	}
+	for i, entry := range expected {
+		if actual[i] != entry {
+			t.Errorf("%s: wrong line entry %d. want=%+v, got=%+v", name, i, entry, actual[i])
+		}
+	}
+}
+
 // Compilation Scopes
 // testing enterScope() and leaveScope()
 func TestCompilerScopes(t *testing.T) {
@@ -589,6 +931,14 @@ func testConstants(
 					err,
 				)
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s",
+					i,
+					err,
+				)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -632,6 +982,24 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("testFloatObject: object is not Float. got=%T (%+v)",
+			actual,
+			actual,
+		)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("testFloatObject: object has wrong value. got=%g, want=%g",
+			result.Value,
+			expected,
+		)
+	}
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -649,55 +1017,24 @@ func testStringObject(expected string, actual object.Object) error {
 
 // Condition Tests
 
-func TestConditionals(t *testing.T) {
+func TestFloatLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input: `
-			if (true) { 10 }; 3333;
-			`,
-			expectedConstants: []interface{}{10, 3333},
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
 			expectedInstructions: []code.Instructions{
-				// 0000
-				code.Make(code.OpTrue),
-				// 0001
-				code.Make(code.OpJumpNotTruthy, 10),
-				// 0004
 				code.Make(code.OpConstant, 0),
-				// 0007
-				code.Make(code.OpJump, 11), // jump to after the alternative
-				// 0010
-				code.Make(code.OpNull), // OpNull is the alternative if no other alternative exists
-				// 0011
-				code.Make(code.OpPop),
-				// 0012
 				code.Make(code.OpConstant, 1),
-				// 0015
+				code.Make(code.OpMul),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input: `
-			if (true) {10} else {20}; 3333;
-			`,
-			expectedConstants: []interface{}{10, 20, 3333},
+			input:             "-2.5e-3",
+			expectedConstants: []interface{}{2.5e-3},
 			expectedInstructions: []code.Instructions{
-				// 0000
-				code.Make(code.OpTrue),
-				// 0001
-				// after condition
-				code.Make(code.OpJumpNotTruthy, 10),
-				// 0004
 				code.Make(code.OpConstant, 0),
-				// 0007
-				code.Make(code.OpJump, 13),
-				// 0010
-				code.Make(code.OpConstant, 1), // alternative
-				// 0013
-				// after alternative
-				code.Make(code.OpPop), // pop (optional) value of conditional
-				// 0014
-				code.Make(code.OpConstant, 2),
-				// 0017
+				code.Make(code.OpMinus),
 				code.Make(code.OpPop),
 			},
 		},
@@ -706,23 +1043,442 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestGlobalLetStatements(t *testing.T) {
-	tests := []compilerTestCase{
-		{
-			input: `
-			let one = 1;
-			let two = 2;
-			`,
+func TestIntegerOperators(t *testing.T) {
+	operators := []struct {
+		operator string
+		opcode   code.Opcode
+	}{
+		{"%", code.OpMod},
+		{"&", code.OpBitAnd},
+		{"|", code.OpBitOr},
+		{"^", code.OpBitXor},
+		{"<<", code.OpShiftLeft},
+		{">>", code.OpShiftRight},
+	}
+
+	tests := []compilerTestCase{}
+	for _, op := range operators {
+		tests = append(tests, compilerTestCase{
+			input:             "1 " + op.operator + " 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSetGlobal, 1),
+				code.Make(op.opcode),
+				code.Make(code.OpPop),
 			},
-		},
-		{
-			input: `
+		})
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && 2; 3",
+			expectedConstants: []interface{}{2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpIfFalsyOrPop, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpConstant, 1),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 || 2 || 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJumpIfTruthyOrPop, 9),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009
+				code.Make(code.OpJumpIfTruthyOrPop, 15),
+				// 0012
+				code.Make(code.OpConstant, 2),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			if (true) { 10 }; 3333;
+			`,
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11), // jump to after the alternative
+				// 0010
+				code.Make(code.OpNull), // OpNull is the alternative if no other alternative exists
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			if (true) {10} else {20}; 3333;
+			`,
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				// after condition
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1), // alternative
+				// 0013
+				// after alternative
+				code.Make(code.OpPop), // pop (optional) value of conditional
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			try { 1 } catch (e) { e }; 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJump, 12), // skip the catch block
+				// 0006
+				code.Make(code.OpSetGlobal, 0), // bind the error pushed by the vm
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			1; try {} catch (e) {};
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpPop),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 12),
+				// 0008
+				code.Make(code.OpSetGlobal, 0),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			throw "boom";
+			`,
+			expectedConstants: []interface{}{"boom"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let x = 1; x = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0), // the value of the assignment
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() { let x = 1; x += 2 }
+			`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let a = [1]; a[0] = 2;
+			`,
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let a = [1]; a[0] -= 1;
+			`,
+			expectedConstants: []interface{}{1, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup, 2), // the array and the index stay for OpSetIndex
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			while (true) { break; }
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10), // break
+				// 0007
+				code.Make(code.OpJump, 0), // back to the condition
+			},
+		},
+		{
+			input: `
+			for (x in [1]) { x; continue; }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpIterNext, 23),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpJump, 7), // continue
+				// 0020
+				code.Make(code.OpJump, 7),
+			},
+		},
+		{
+			// break drops the 1 and the iterator before it leaves the loop
+			input: `
+			for (x in []) { 1 + if (x) { break } }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpArray, 0),
+				// 0003
+				code.Make(code.OpIter),
+				// 0004
+				code.Make(code.OpIterNext, 33),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpJumpNotTruthy, 27),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpPop),
+				// 0021
+				code.Make(code.OpJump, 33), // break
+				// 0024
+				code.Make(code.OpJump, 28),
+				// 0027
+				code.Make(code.OpNull),
+				// 0028
+				code.Make(code.OpAdd),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpJump, 4),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoopControlOutsideOfLoop(t *testing.T) {
+	// the parser rejects these, so build the programs by hand
+	pos := token.Position{Line: 1, Column: 1}
+	tests := []struct {
+		stmt     ast.Statement
+		expected string
+	}{
+		{&ast.BreakStatement{Token: token.Token{Type: token.BREAK, Literal: "break", Pos: pos}},
+			"compiler: 1:1: break outside of a loop"},
+		{&ast.ContinueStatement{Token: token.Token{Type: token.CONTINUE, Literal: "continue", Pos: pos}},
+			"compiler: 1:1: continue outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		program := &ast.Program{Statements: []ast.Statement{tt.stmt}}
+
+		err := New().Compile(program)
+		if err == nil {
+			t.Errorf("expected compiler error for %s", tt.stmt)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestHandlerTables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected code.HandlerTable
+	}{
+		{
+			input:    `try { 1 } catch (e) { e };`,
+			expected: code.HandlerTable{{Start: 0, End: 3, Target: 6, Depth: 0}},
+		},
+		{
+			// the inner handler comes first and the outer one keeps the
+			// inner try's value on the stack
+			input: `try { 1 + try { 2 } catch (e) { 3 } } catch (e) { 4 };`,
+			expected: code.HandlerTable{
+				{Start: 3, End: 6, Target: 9, Depth: 1},
+				{Start: 0, End: 16, Target: 19, Depth: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		handlers := compiler.Bytecode().Handlers
+		if !reflect.DeepEqual(handlers, tt.expected) {
+			t.Errorf("wrong handlers for %q.\nwant=%+v\ngot =%+v", tt.input, tt.expected, handlers)
+		}
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let one = 1;
+			let two = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input: `
 let one = 1;
 one;
 `,
@@ -773,7 +1529,7 @@ func TestLetStatementScopes(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -794,7 +1550,7 @@ func TestLetStatementScopes(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -821,11 +1577,283 @@ func TestLetStatementScopes(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 4),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					a + b
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) {
+						a + b + c
+					}
+				}
+			};
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let global = 55;
+
+			fn() {
+				let a = 66;
+
+				fn() {
+					let b = 77;
+
+					fn() {
+						let c = 88;
+
+						global + a + b + c;
+					}
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				55,
+				66,
+				77,
+				88,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 4, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 5, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 6, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); };
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { countDown(x - 1); };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// isEven captures the cell of isOdd before isOdd is assigned
+			input: `
+			fn() {
+				let isEven = fn(n) { isOdd(n) };
+				let isOdd = fn(n) { isEven(n) };
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 1),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
 	}
+
 	runCompilerTests(t, tests)
 }
 
@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/module"
+	"monkey/object"
+)
+
+// compileImport compiles the module of node where it's imported first, so
+// its code runs there once and leaves the namespace of the module in a
+// global of its own. Every import binds that global to the name of the import.
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	file, err := c.loader.Resolve(node.Path, node.Pos().File)
+	if err != nil {
+		return fmt.Errorf("%s: %s", node.Pos(), err)
+	}
+
+	symbol, ok := c.symbolTable.globals.modules[file]
+	if !ok {
+		program, err := c.loader.Load(file)
+		if err != nil {
+			return fmt.Errorf("%s: %s", node.Pos(), err)
+		}
+		symbol, err = c.compileModule(file, program)
+		c.loader.Done()
+		if err != nil {
+			return err
+		}
+	}
+
+	c.loadSymbol(symbol)
+	c.storeSymbol(c.symbolTable.Define(node.Name.Value))
+	return nil
+}
+
+// compileModule compiles the program of the module in file with a global
+// symbol table of its own. Its exports are globals, the namespace is built
+// from them after the code of the module ran.
+func (c *Compiler) compileModule(file string, program *ast.Program) (Symbol, error) {
+	outer := c.symbolTable
+	c.symbolTable = NewModuleSymbolTable(outer)
+	defer func() { c.symbolTable = outer }()
+
+	if err := c.Compile(program); err != nil {
+		return Symbol{}, err
+	}
+
+	exports := module.Exports(program)
+	for _, name := range exports {
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpModule, c.addConstant(&object.String{Value: module.Name(file)}), len(exports))
+
+	// no identifier looks like this, so the module can't shadow anything
+	symbol := c.symbolTable.Define("<module " + file + ">")
+	c.storeSymbol(symbol)
+	c.symbolTable.globals.modules[file] = symbol
+	return symbol, nil
+}
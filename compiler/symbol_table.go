@@ -1,10 +1,15 @@
 package compiler
 
+import "monkey/object"
+
 type SymbolScope string
 
 const (
-	LocalScope  SymbolScope = "LOCAL"
-	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	GlobalScope   SymbolScope = "GLOBAL"
+	FreeScope     SymbolScope = "FREE"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
@@ -18,16 +23,46 @@ type SymbolTable struct {
 
 	store          map[string]Symbol
 	numDefinitions int
+
+	// FreeSymbols holds the original symbols of the enclosing scopes
+	// that were captured by this scope, in the order they were captured
+	FreeSymbols []Symbol
+
+	// globals is shared by the global tables of a program and of the modules
+	// it imports, nil in the tables of functions
+	globals *globalTable
+}
+
+// globalTable is the module globals table. The program and its modules
+// each have a global symbol table but they share the globals of the vm,
+// so their globals take the next free slot from here.
+type globalTable struct {
+	names   []string          // of the global slots by index
+	modules map[string]Symbol // global holding the module, by file
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
-	return &SymbolTable{store: s}
+	free := []Symbol{}
+	globals := &globalTable{modules: map[string]Symbol{}}
+	return &SymbolTable{store: s, FreeSymbols: free, globals: globals}
 }
 
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
 	s.Outer = outer
+	s.globals = nil
+	return s
+}
+
+// NewModuleSymbolTable returns the global table of a module imported by
+// the program of the global table program, with the builtins defined
+func NewModuleSymbolTable(program *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.globals = program.globals
+	for i, v := range object.Builtins {
+		s.DefineBuiltin(i, v.Name)
+	}
 	return s
 }
 
@@ -38,11 +73,40 @@ func (s *SymbolTable) Define(name string) Symbol {
 	} else {
 		symbol.Scope = LocalScope
 	}
+
+	// defining a name of this table again reuses its slot, like let in the
+	// evaluator rebinds the name, so a loop body can update the variables
+	// its condition reads
+	if existing, ok := s.store[name]; ok && existing.Scope == symbol.Scope {
+		return existing
+	}
+
+	if symbol.Scope == GlobalScope {
+		symbol.Index = len(s.globals.names)
+		s.globals.names = append(s.globals.names, name)
+	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// DefineBuiltin defines a builtin function by its index in object.Builtins
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName defines the name of the function currently being compiled,
+// so the function can refer to itself without capturing itself as a free variable
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks up name in this and all enclosing tables.
+// Locals of an enclosing function are turned into free symbols of this table.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -50,9 +114,67 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 		if !ok {
 			return obj, ok
 		}
-		if obj.Scope == GlobalScope {
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
 			return obj, ok
 		}
+
+		free := s.defineFree(obj)
+		return free, true
 	}
 	return obj, ok
 }
+
+// defineFree remembers the original symbol and shadows it with a FreeScope symbol
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// globalNames returns the names of the global slots by index, those of
+// the modules included
+func (s *SymbolTable) globalNames() []string {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	names := make([]string, len(s.globals.names))
+	copy(names, s.globals.names)
+	return names
+}
+
+// ForgetUnloadedModules drops the modules whose global isn't set in globals,
+// so the next import compiles and runs them again. The REPL calls this when
+// a line failed before the code of a module it imported ran.
+func (s *SymbolTable) ForgetUnloadedModules(globals []object.Object) {
+	for file, symbol := range s.globals.modules {
+		if globals[symbol.Index] == nil {
+			delete(s.globals.modules, file)
+		}
+	}
+}
+
+// origin returns the symbol a free symbol was captured from, in the
+// function that defines the variable
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	for symbol.Scope == FreeScope {
+		symbol = s.FreeSymbols[symbol.Index]
+		s = s.Outer
+	}
+	return symbol
+}
+
+// localNames returns the names of the local slots by index
+func (s *SymbolTable) localNames() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == LocalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
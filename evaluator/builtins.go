@@ -1,125 +1,48 @@
 package evaluator
 
 import (
-	"fmt"
 	"monkey/object"
 )
 
 // builtins is a map of builtin functions
-// this is where we implement the builtins
+// the implementations live in object.Builtins and are shared with the vm
 var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s",
-					args[0].Type())
-			}
-		},
-	},
-	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			// check number of arguments
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			// check array type
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to 'first' must be ARRAY, got %s", args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-			return NULL
-		},
-	},
-	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			// check number of arguments
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			// check array type
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to 'last' must be ARRAY, got %s", args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length-1]
-			}
-
-			return NULL
-		},
-	},
-	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got=%s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
-			}
-
-			return NULL
-		},
-	},
-	// TODO: turn this into a push for a list of objects
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=%d",
-					len(args),
-					2,
-				)
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got=%s",
-					args[0].Type(),
-				)
-			}
-			// don't need to check for second input type since array can store multilpe
-			// elements of different types
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-
-			return NULL
-		},
-	},
+	"len":         object.GetBuiltinByName("len"),
+	"first":       object.GetBuiltinByName("first"),
+	"last":        object.GetBuiltinByName("last"),
+	"rest":        object.GetBuiltinByName("rest"),
+	"push":        object.GetBuiltinByName("push"),
+	"puts":        object.GetBuiltinByName("puts"),
+	"int":         object.GetBuiltinByName("int"),
+	"float":       object.GetBuiltinByName("float"),
+	"format":      object.GetBuiltinByName("format"),
+	"split":       object.GetBuiltinByName("split"),
+	"join":        object.GetBuiltinByName("join"),
+	"trim":        object.GetBuiltinByName("trim"),
+	"upper":       object.GetBuiltinByName("upper"),
+	"lower":       object.GetBuiltinByName("lower"),
+	"replace":     object.GetBuiltinByName("replace"),
+	"contains":    object.GetBuiltinByName("contains"),
+	"starts_with": object.GetBuiltinByName("starts_with"),
+	"ends_with":   object.GetBuiltinByName("ends_with"),
+	"index_of":    object.GetBuiltinByName("index_of"),
+	"substr":      object.GetBuiltinByName("substr"),
+	"repeat":      object.GetBuiltinByName("repeat"),
+	"chars":       object.GetBuiltinByName("chars"),
+	"map":         object.GetBuiltinByName("map"),
+	"filter":      object.GetBuiltinByName("filter"),
+	"reduce":      object.GetBuiltinByName("reduce"),
+	"sort":        object.GetBuiltinByName("sort"),
+	"any":         object.GetBuiltinByName("any"),
+	"all":         object.GetBuiltinByName("all"),
+	"range":       object.GetBuiltinByName("range"),
+	"zip":         object.GetBuiltinByName("zip"),
+	"enumerate":   object.GetBuiltinByName("enumerate"),
+	"reverse":     object.GetBuiltinByName("reverse"),
+	"keys":        object.GetBuiltinByName("keys"),
+	"values":      object.GetBuiltinByName("values"),
+	"items":       object.GetBuiltinByName("items"),
+	"has":         object.GetBuiltinByName("has"),
+	"delete":      object.GetBuiltinByName("delete"),
+	"merge":       object.GetBuiltinByName("merge"),
 }
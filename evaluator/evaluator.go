@@ -2,20 +2,36 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"monkey/ast"
+	"monkey/module"
 	"monkey/object"
+	"strings"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.True
+	FALSE = object.False
 	NULL  = &object.Null{}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-// we let Eval take care of
+// Eval evaluates node, errors are tagged with the position of the
+// innermost node they came up in
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok && !err.Caught && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+// we let eval take care of
 //   - what the node is
 //   - how to evaluate it	*/
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -26,43 +42,73 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return object.NewThrownError(val)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		// binding node.Name.Value -> val
 		env.Set(node.Name.Value, val)
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
 
 		// Expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value} // check literal values before checking object wrappers to avoid comparing pointers
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
-		right := Eval(node.Right, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
-		if isError(right) {
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
@@ -71,28 +117,40 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Function{Parameters: params, Body: body, Env: env}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(function, args, env.Output())
 	case *ast.ArrayLiteral:
 		// eval the Array node.elements and return the array object
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
+	case *ast.InterpolatedString:
+		parts := evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isAbrupt(parts[0]) {
+			return parts[0]
+		}
+		var out strings.Builder
+		for _, part := range parts {
+			out.WriteString(part.Inspect())
+		}
+		return &object.String{Value: out.String()}
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env) // get array object
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env) // eval index from indexExpression
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
@@ -113,7 +171,9 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
-			return result
+			if !result.Caught {
+				return result
+			}
 		}
 	}
 	return result
@@ -130,11 +190,9 @@ func evalBlockStatement(
 
 		// not returning the result, instead returning *object.ReturnValue without unwrapping .Value
 		// this bubbles up to evalProgram, which finally unwraps the .Value
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		// break and continue bubble up to the loop the same way
+		if isAbrupt(result) {
+			return result
 		}
 	}
 	return result
@@ -155,12 +213,15 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		// an integer mixed with a float is promoted to float
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -170,12 +231,91 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// evalLogicalExpression evaluates the right side of && and || only when the
+// left side doesn't decide the result, the result is the last value evaluated
+func evalLogicalExpression(
+	ie *ast.InfixExpression,
+	env *object.Environment,
+) object.Object {
+	left := Eval(ie.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if isTruthy(left) == (ie.Operator == "||") {
+		return left
+	}
+	return Eval(ie.Right, env)
+}
+
+// evalAssignExpression stores the value in a variable or in an element of an
+// array or hash, the variable is updated where it was defined
+func evalAssignExpression(
+	ae *ast.AssignExpression,
+	env *object.Environment,
+) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if ae.Operator != "=" {
+			current = evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(ae, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if !env.Assign(target.Value, val) {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		var current object.Object
+		if ae.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(ae, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return evalIndexAssignment(left, index, val)
+	}
+	return newError("cannot assign to %s", ae.Target.String())
+}
+
+// evalAssignedValue evaluates the right side of an assignment,
+// combined with the current value of the target for += and -=
+func evalAssignedValue(
+	ae *ast.AssignExpression,
+	current object.Object,
+	env *object.Environment,
+) object.Object {
+	val := Eval(ae.Value, env)
+	if isAbrupt(val) || ae.Operator == "=" {
+		return val
+	}
+	return evalInfixExpression(ae.Operator[:1], current, val)
+}
+
 func evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
 ) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -187,6 +327,86 @@ func evalIfExpression(
 	}
 }
 
+func evalWhileStatement(
+	ws *ast.WhileStatement,
+	env *object.Environment,
+) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, stop := evalLoopBody(ws.Body, env); stop {
+			return result
+		}
+	}
+}
+
+func evalForStatement(
+	fs *ast.ForStatement,
+	env *object.Environment,
+) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	it, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("not iterable: %s", iterable.Type())
+	}
+
+	for {
+		element, ok := it.Next()
+		if !ok {
+			return nil
+		}
+		env.Set(fs.Variable.Value, element)
+
+		if result, stop := evalLoopBody(fs.Body, env); stop {
+			return result
+		}
+	}
+}
+
+// evalLoopBody runs one iteration of a loop, stop is set when the loop ends
+// early, result is what the loop evaluates to then
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, stop bool) {
+	result = Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+
+	switch {
+	case result.Type() == object.BREAK_OBJ:
+		return nil, true
+	case result.Type() == object.RETURN_VALUE_OBJ || isError(result):
+		return result, true
+	}
+	return nil, false
+}
+
+// evalTryExpression evaluates the catch block when the try block fails,
+// the error is bound to the catch parameter as an ordinary value
+func evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := Eval(te.Block, env)
+	if !isError(result) {
+		return result
+	}
+
+	err := result.(*object.Error)
+	caught := &object.Error{Message: err.Message, Pos: err.Pos, Caught: true}
+	env.Set(te.Parameter.Value, caught)
+
+	return Eval(te.Catch, env)
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -209,7 +429,7 @@ func evalExpressions(
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -222,11 +442,11 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Keys))
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -235,15 +455,14 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := Eval(node.Pairs[keyNode], env)
+		if isAbrupt(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 // eval Hash (access Hashmap with hash)
@@ -255,12 +474,53 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
+}
+
+// evalImportStatement binds the module to the name of the import. The first
+// import of a module runs it in its own environment, later imports get the
+// same module again.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	imports := env.Imports()
+
+	file, err := imports.Loader.Resolve(node.Path, node.Pos().File)
+	if err != nil {
+		return imports.LoadFailed(newError("%s", err))
+	}
+
+	mod, ok := imports.Get(file)
+	if !ok {
+		program, err := imports.Loader.Load(file)
+		if err != nil {
+			return imports.LoadFailed(newError("%s", err))
+		}
+		moduleEnv := object.NewEnvironment()
+		moduleEnv.SetImports(imports)
+		moduleEnv.SetOutput(env.Output())
+
+		result := Eval(program, moduleEnv)
+		imports.Loader.Done()
+		if isError(result) {
+			return result
+		}
+
+		names := module.Exports(program)
+		exports := object.NewHash(len(names))
+		for _, name := range names {
+			value, _ := moduleEnv.Get(name)
+			exports.Set(&object.String{Value: name}, value)
+		}
+		mod = &object.Module{Name: module.Name(file), Exports: exports}
+		imports.Add(file, mod)
+	}
+
+	env.Set(node.Name.Value, mod)
+	return nil
 }
 
 // Functions
@@ -270,20 +530,36 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 //	- finally, unwrap the return value from inside the extended environment into the current environment
 //*/
 
-// applyFunction calls to extend the function's env, then evaluates the function's body in the extended env
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls to extend the function's env, then evaluates the function's body in the extended env.
+// builtins print to out
+func applyFunction(fn object.Object, args []object.Object, out io.Writer) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(fn.Parameters), len(args))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Call(callFunction(out), out, args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// callFunction returns how higher order builtins like map call functions,
+// the builtins they call print to out
+func callFunction(out io.Writer) object.CallFunction {
+	return func(fn object.Object, args ...object.Object) object.Object {
+		return applyFunction(fn, args, out)
+	}
+}
+
 // extendFunctionEnv creates an enclosed env, then binds the function's new parameters to the env
 func extendFunctionEnv(
 	fn *object.Function,
@@ -345,30 +621,64 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
+// evalIntegerInfixExpression compares two integers, or leaves the
+// arithmetic to object.IntegerOperation
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+	switch operator {
+	case "<", ">", "==", "!=", "<=", ">=":
+		cmp, _ := object.Compare(left, right)
+		return evalOrdering(operator, cmp)
+	}
+
+	result, err := object.IntegerOperation(operator, left, right)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
+
+// evalOrdering is the result of the comparison operator for cmp, the
+// result of object.Compare
+func evalOrdering(operator string, cmp int) object.Object {
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(cmp > 0)
+	case "==":
+		return nativeBoolToBooleanObject(cmp == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(cmp != 0)
+	case "<=":
+		return nativeBoolToBooleanObject(cmp <= 0)
+	default:
+		return nativeBoolToBooleanObject(cmp >= 0)
+	}
+}
+
+// evalFloatInfixExpression compares two numbers as floats, or leaves the
+// arithmetic to object.FloatOperation
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal, _ := object.FloatValue(left)
+	rightVal, _ := object.FloatValue(right)
 
 	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	// comparing literal values before comparing object wrappers to avoid comparing pointers
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -381,28 +691,42 @@ func evalIntegerInfixExpression(
 		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case ">=":
 		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	case "&&":
-		return nativeBoolToBooleanObject(leftVal != 0 && rightVal != 0)
-	case "||":
-		return nativeBoolToBooleanObject(leftVal != 0 || rightVal != 0)
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
 	}
+
+	result, err := object.FloatOperation(operator, left, right)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
 }
 
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	// comparing UTF-8 bytewise orders strings by code point
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 // Array Expressions
@@ -410,31 +734,117 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.Error).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		mod := left.(*object.Module)
+		if export, ok := mod.Export(index.(*object.String).Value); ok {
+			return export
+		}
+		return newError("module %s has no export %s", mod.Name, index.Inspect())
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
+// evalSliceExpression evaluates left[start:end], a bound that is left out
+// is NULL for object.Slice
+func evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(se.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{se.Start, se.End} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isAbrupt(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	result, err := object.Slice(left, bounds[0], bounds[1])
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
+
+// evalIndexAssignment sets the element of an array or hash in place
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		idx, ok := object.SequenceIndex(index, len(elements))
+		if !ok {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		elements[idx] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Set(key, val)
+		return val
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	last := int64(len(arrayObject.Elements) - 1)
+	elements := array.(*object.Array).Elements
 
-	if idx < 0 || idx > last {
+	idx, ok := object.SequenceIndex(index, len(elements))
+	if !ok {
 		return NULL
 	}
-	return arrayObject.Elements[idx]
+	return elements[idx]
+}
+
+// evalStringIndexExpression returns the code point at index as a string
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+
+	idx, ok := object.SequenceIndex(index, len(runes))
+	if !ok {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
 }
 
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// isAbrupt reports whether obj cuts the evaluation of the enclosing
+// expressions and blocks short: an error that wasn't caught, or the
+// value of a return, break or continue statement
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return isError(obj)
+}
+
+// isError reports whether obj is an error that wasn't caught
 func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+	if err, ok := obj.(*object.Error); ok {
+		return !err.Caught
 	}
 	return false
 }
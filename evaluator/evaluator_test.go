@@ -1,9 +1,15 @@
 package evaluator
 
 import (
+	"math"
+	"math/big"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +33,17 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 + 2 & 3", 3},
+		{"2 * 3 % 4", 2},
+		{"1 << 2 + 1", 5},
+		{"(1 | 2) ^ 7", 4},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -34,6 +51,47 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"0.25 + 0.5", 0.75},
+		{"5 / 2.0", 2.5},
+		{"2.0 * 3", 6.0},
+		{"1 - 0.5", 0.5},
+		{"7.5 % 2", 1.5},
+		{"1.0 / 0", math.Inf(1)},
+		{"1 < 1.5", true},
+		{"2.0 == 2", true},
+		{"2.5 != 2.5", false},
+		{"2.5 >= 3", false},
+		{"0.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"-true", "unknown operator: -BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -57,6 +115,79 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1 | 2 == 3", true},
+		{"6 & 1 == 0", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 <= 3 || false", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+// the operands of a comparison are evaluated left to right, whatever the operator
+func TestComparisonOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let log = ""; let l = fn() { log += "l"; 1 }; let r = fn() { log += "r"; 2 }; l() < r(); l() <= r(); r() > l(); log`, "lrlrrl"},
+		{`let i = 0; let a = [1, 2, 3]; a[i += 1] < a[i += 1]`, true},
+		{`let i = 0; let a = [3, 2, 1]; a[i += 1] <= a[i += 1]`, false},
+		{`1.5 < 2`, true},
+		{`2 <= 1.5`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`1 < 9223372036854775807 + 1`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" < "abd"`, true},
+		{`"ab" < "abc"`, true},
+		{`"b" < "ä"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "c"`, false},
+		{`"b" > "a"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1] == [1, 1]`, false},
+		{`[1.0] == [1]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{} == []`, false},
+		{`1 == "1"`, false},
+		{`first([]) == first([])`, true},
+		{`first([]) == false`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let a = [1, 0]; a[1] = a; a == a`, true},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -64,6 +195,92 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{"9223372036854775808", bigInt("9223372036854775808")},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"-9223372036854775808 == -9223372036854775807 - 1", true},
+		{"-9223372036854775807 - 2", bigInt("-9223372036854775809")},
+		{"4294967296 * 4294967296", bigInt("18446744073709551616")},
+		{"1 << 64", bigInt("18446744073709551616")},
+		{"(-9223372036854775807 - 1) / -1", bigInt("9223372036854775808")},
+		{"-(-9223372036854775807 - 1)", bigInt("9223372036854775808")},
+		{"(1 << 100) + 1 - (1 << 100)", 1},
+		{"(1 << 100) / (1 << 98)", 4},
+		{"(1 << 100) % 7", 2},
+		{"(1 << 100) >> 98", 4},
+		{"-(1 << 100) >> 200", -1},
+		{"(1 << 64) & 1", 0},
+		{"(1 << 64) | 1", bigInt("18446744073709551617")},
+		{"(1 << 100) > 9223372036854775807", true},
+		{"(1 << 64) == (1 << 64)", true},
+		{"(1 << 64) != 1", true},
+		{"-(1 << 64) <= -1", true},
+		{"(1 << 64) * 0.5", 9223372036854775808.0},
+		{"{(1 << 64): 1}[1 << 64]", 1},
+		{"[1][1 << 64]", nil},
+		{"int(1e30)", bigInt("1000000000000000019884624838656")},
+		{`int("123456789012345678901234567890")`, bigInt("123456789012345678901234567890")},
+		{"try { 1 / 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { (1 << 64) / 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { (1 << 64) % 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { 1 << (1 << 64) } catch (e) { e[\"message\"] }", "shift count too large: 18446744073709551616"},
+		{"try { (1 << 64) << -1 } catch (e) { e[\"message\"] }", "negative shift count: -1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		default:
+			testExpectedObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 && 6", 6},
+		{"false && 6", false},
+		{"if (false) { 1 } && 6", nil},
+		{"0 || 6", 0},
+		{"if (false) { 1 } || 6", 6},
+		{`"" || "x"`, ""},
+		{"false && (1 + true)", false},
+		{"true || (1 + true)", true},
+		{"let n = 0; let f = fn(x) { n += 1; x }; f(false) && f(true); f(true) || f(true); n", 2},
+		{"1 + (false || 2) * 3", 7},
+		{"[true && 1, false || 2]", []int{1, 2}},
+		{"let x = 0; while (x < 10 && x != 5) { x += 1 }; x", 5},
+		{"try { 1 % 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { 1 << -1 } catch (e) { e[\"message\"] }", "negative shift count: -1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testExpectedObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -193,6 +410,22 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) {x}];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"puts(f); let f = fn() { 1 };",
+			"identifier not found: f",
+		},
+		{
+			"let x = f + 1; let f = fn() { 1 };",
+			"identifier not found: f",
+		},
+		{
+			"let g = fn() { let y = h; let h = fn() { 1 }; y }; g()",
+			"identifier not found: h",
+		},
+		{
+			"let f = fn() { let k = fn() { h() }; let x = k(); let h = fn() { 1 }; x }; f()",
+			"identifier not found: h",
+		},
 	}
 
 	for _, tt := range tests {
@@ -210,6 +443,33 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedInspect string
+	}{
+		{"5 + true;", "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1;\n  foobar", "ERROR: 2:3: identifier not found: foobar"},
+		{"if (true) {\n\t-true\n}", "ERROR: 2:2: unknown operator: -BOOLEAN"},
+		{"let f = fn(a) {\n a + true };\nf(1)", "ERROR: 2:4: type mismatch: INTEGER + BOOLEAN"},
+		{`len(1)`, "ERROR: 1:4: argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong error. expected=%q, got=%q",
+				tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
 // TestLetStatements tests the binding of values to identifiers
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
@@ -280,6 +540,45 @@ addTwo(2);`
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`
+			let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);
+			`,
+			610,
+		},
+		{
+			`
+			let wrapper = fn() {
+				let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+				let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+				isOdd(7);
+			};
+			wrapper();
+			`,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -293,6 +592,56 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a\tb"`, "a\tb"},
+		{`"\u{1F600}"`, "\U0001F600"},
+		{`len("日本語")`, 3},
+		{`len("\u{1F600}!")`, 2},
+		{`"日本語"[1]`, "本"},
+		{`"héllo"[4]`, "o"},
+		{`"abc"[3]`, nil},
+		{`let größe = "ö"; größe + größe`, "öö"},
+		{`let n = 0; for (c in "añb") { n += 1 }; n`, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.expected == nil {
+			testNullObject(t, evaluated)
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${1}${"a"}${true}"`, "1atrue"},
+		{`"list ${[1, "x"]} and ${2.5 * 2}!"`, "list [1,x] and 5.0!"},
+		{`let f = fn(n) { "n=${n}" }; f(7) + "."`, "n=7."},
+		{`"outer ${"inner ${1 + 1}"}"`, "outer inner 2"},
+		{`"${ {"k": "v"}["k"] }"`, "v"},
+		{`"cost: \${x}"`, "cost: ${x}"},
+		{`format("%s is %d years", "Kim", 30)`, "Kim is 30 years"},
+		{`format("%6.2f|%-4v|", 3.14159, true)`, "  3.14|true|"},
+		{`try { format("%d", "x") } catch (e) { e["message"] }`, "argument 2 to `format` must be INTEGER, got STRING"},
+		{`try { "${1 + true}" } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 
@@ -316,14 +665,35 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`last([1, 2, 3])`, 3},
+		{`rest([])`, nil},
+		{`puts("hello")`, nil},
+		{`int(2.9)`, 2},
+		{`int(-2.9)`, -2},
+		{`int(" 42 ")`, 42},
+		{`int(7)`, 7},
+		{`int("4.2")`, `could not parse "4.2" as integer`},
+		{`int(1.0 / 0)`, "cannot convert +Inf to INTEGER"},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{`float(3)`, 3.0},
+		{`float("1e-3")`, 0.001},
+		{`float("x")`, `could not parse "x" as float`},
+		{`float(5) / 2`, 2.5},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 
 		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
@@ -339,6 +709,497 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`split("a,b,,c", ",")`, []string{"a", "b", "", "c"}},
+		{`split("äbc", "")`, []string{"ä", "b", "c"}},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"], ", ")`, "1, true, x"},
+		{`join([], ",")`, ""},
+		{`trim("  \t monkey \n")`, "monkey"},
+		{`upper("äb")`, "ÄB"},
+		{`lower("ÄB")`, "äb"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "x")`, false},
+		{`if (contains("a", "a")) { "yes" } else { "no" }`, "yes"},
+		{`contains("a", "a") == true`, true},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`index_of("häystack", "st")`, 3},
+		{`index_of("abc", "x")`, -1},
+		{`substr("hällo", 1)`, "ällo"},
+		{`substr("hällo", 1, 3)`, "äll"},
+		{`substr("hällo", 4, 10)`, "o"},
+		{`substr("abc", 3)`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("", 1 << 70)`, ""},
+		{`chars("añb")`, []string{"a", "ñ", "b"}},
+		{`try { split("a") } catch (e) { e["message"] }`, "wrong number of arguments. got=1, want=2"},
+		{`try { split("a", 1) } catch (e) { e["message"] }`, "argument 2 to `split` must be STRING, got INTEGER"},
+		{`try { upper(1) } catch (e) { e["message"] }`, "argument to `upper` must be STRING, got INTEGER"},
+		{`try { join("a", ",") } catch (e) { e["message"] }`, "argument 1 to `join` must be ARRAY, got STRING"},
+		{`try { substr("abc") } catch (e) { e["message"] }`, "wrong number of arguments. got=1, want=2 or 3"},
+		{`try { substr("abc", 4) } catch (e) { e["message"] }`, "argument 2 to `substr` must be between 0 and 3, got 4"},
+		{`try { substr("abc", 0, -1) } catch (e) { e["message"] }`, "argument 3 to `substr` must not be negative, got -1"},
+		{`try { repeat("a", -1) } catch (e) { e["message"] }`, "argument 2 to `repeat` must not be negative, got -1"},
+		{`try { repeat("a", 1 << 70) } catch (e) { e["message"] }`, "argument 2 to `repeat` is too large, got 1180591620717411303424"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, expected)
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int{}},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, []int{11, 12}},
+		{`map(["a", "b"], upper)`, []string{"A", "B"}},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, []int{2, 4}},
+		{`filter([1, first([]), 2, false], fn(x) { x })`, []int{1, 2}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`reduce(range(1, 30), 1, fn(acc, x) { acc * x })`, bigInt("8841761993739701954543616000000")},
+		{`sort([3, 1.5, 2, -1])[0]`, -1},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort(["b", "ä", "a"])`, []string{"a", "b", "ä"}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`map(sort([[2, "b"], [1, "x"], [2, "a"]], fn(a, b) { a[0] < b[0] }), fn(p) { p[1] })`, []string{"x", "b", "a"}},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`any([], fn(x) { true })`, false},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, false},
+		{`range(4)`, []int{0, 1, 2, 3}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(10, 0, -3)`, []int{10, 7, 4, 1}},
+		{`range(5, 2)`, []int{}},
+		{`len(range(-9223372036854775807, 9223372036854775807, 4611686018427387904))`, 4},
+		{`zip([1, 2, 3], ["a", "b"])[1][1]`, "b"},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`enumerate(["a", "b"])[1][0]`, 1},
+		{`enumerate(["a", "b"])[1][1]`, "b"},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`reverse("häy")`, "yäh"},
+		{`contains([1, "a", 2.0], 2)`, true},
+		{`contains([1, "a"], "a")`, true},
+		{`contains([1, "a"], "b")`, false},
+		{`contains([[1, 2], {"a": 1}], {"a": 1})`, true},
+		{`contains([true, first([])], first([]))`, true},
+		{`let f = fn(n) { map(range(n), fn(x) { if (x > 0) { f(x) } else { 0 } }) }; len(f(4))`, 4},
+		{`try { map([1, 2], fn(x) { throw "boom" }) } catch (e) { e["message"] }`, "boom"},
+		{`try { map([1, 2], fn(x) { if (x == 2) { throw "two" }; x }) } catch (e) { e["message"] }`, "two"},
+		{`map([1, 2], fn(x) { try { throw "x" } catch (e) { x * 10 } })`, []int{10, 20}},
+		{`let r = try { map([1], fn(x) { x + true }) } catch (e) { 1 }; r + 1`, 2},
+		{`try { map([1], fn(a, b) { a }) } catch (e) { e["message"] }`, "wrong number of arguments: want=2, got=1"},
+		{`try { map([1], 2) } catch (e) { e["message"] }`, "argument 2 to `map` must be FUNCTION, got INTEGER"},
+		{`try { reduce([1], 0, 1) } catch (e) { e["message"] }`, "argument 3 to `reduce` must be FUNCTION, got INTEGER"},
+		{`try { sort([1, "a"]) } catch (e) { e["message"] }`, "cannot compare STRING and INTEGER"},
+		{`try { sort([1, 2], fn(a, b) { 1 }) } catch (e) { e["message"] }`, "sort function must return BOOLEAN, got INTEGER"},
+		{`try { range(1, 2, 0) } catch (e) { e["message"] }`, "range step must not be 0"},
+		{`try { range(1 << 40) } catch (e) { e["message"] }`, "range too large: 1099511627776 elements"},
+		{`try { reverse(1) } catch (e) { e["message"] }`, "argument to `reverse` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, expected)
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`keys({"b": 1, "a": 2, 3: 3})[0]`, "b"},
+		{`keys({"b": 1, "a": 2})`, []string{"b", "a"}},
+		{`values({"b": 1, "a": 2})`, []int{1, 2}},
+		{`items({"b": 1, "a": 2})[1][0]`, "a"},
+		{`items({"b": 1, "a": 2})[1][1]`, 2},
+		{`keys({})`, []int{}},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({1: 1}, 1.0)`, true},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); [len(h), len(d), d["b"]]`, []int{2, 1, 2}},
+		{`keys(delete({"a": 1}, "x"))`, []string{"a"}},
+		{`let h = merge({"a": 1, "b": 2}, {"b": 20, "c": 30}); values(h)`, []int{1, 20, 30}},
+		{`let h = {"a": 1}; h["c"] = 3; h["b"] = 2; h["a"] = 0; keys(h)`, []string{"a", "c", "b"}},
+		{`let h = delete({"a": 1, "b": 2}, "a"); h["a"] = 1; keys(h)`, []string{"b", "a"}},
+		{`let s = ""; for (k in {"z": 1, "y": 2, "x": 3}) { s += k }; s`, "zyx"},
+		{`format("%v", {"b": 1, "a": [2]})`, "{b: 1, a: [2]}"},
+		{`try { keys([1]) } catch (e) { e["message"] }`, "argument to `keys` must be HASH, got ARRAY"},
+		{`try { has({}, [1]) } catch (e) { e["message"] }`, "unusable as hash key: ARRAY"},
+		{`try { merge({}, 1) } catch (e) { e["message"] }`, "argument 2 to `merge` must be HASH, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, expected)
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`try { throw 5 } catch (e) { e["message"] }`, "5"},
+		{"let x = 1;\ntry {\n  x + true } catch (e) { e[\"line\"] * 10 + e[\"column\"] }", 35},
+		{`try { 1 } catch (e) { 2 }; 3`, 3},
+		{`try { throw "x" } catch (e) { e["nothing"] }`, nil},
+		{`1 + try { [2, 3 + true] } catch (e) { 10 }`, 11},
+		{`
+		let inner = fn(x) { if (x > 1) { throw "too big" }; x };
+		let middle = fn(x) { 1 + inner(x) };
+		try { middle(1) + middle(5) } catch (e) { e["message"] }
+		`, "too big"},
+		{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e["message"] }`, "inner"},
+		{`try { try { throw "inner" } catch (e) { 1 } } catch (e) { 2 }`, 1},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, 1},
+		{`let e = try { throw "x" } catch (e) { e }; [e][0]["message"]`, "x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; x = 2; x`, 2},
+		{`let x = 1; x = x + 1`, 2},
+		{`let x = 10; x += 5; x -= 3; x`, 12},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		// assignments update the variable where it's defined
+		{`let count = 0; let inc = fn() { count += 1; }; inc(); inc(); count`, 2},
+		{`let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x`, 7},
+		{`let f = fn(n) { n += 1; n }; f(1)`, 2},
+		{`let f = fn() { let i = 0; let sum = 0; while (i < 4) { i += 1; sum += i; }; sum }; f()`, 10},
+		// elements of arrays and hashes are set in place
+		{`let a = [1, 2, 3]; a[0] = 5; a`, []int{5, 2, 3}},
+		{`let a = [1, 2, 3]; a[2] += 10; a[2]`, 13},
+		{`let a = [1, 2]; let b = a; b[0] = 9; a`, []int{9, 2}},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] -= 1; [h["a"], h["b"]]`, []int{0, 2}},
+		{`let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]`, 3},
+		{`let a = [[1], [2]]; a[1][0] = 7; a[1]`, []int{7}},
+		{`let a = [0, 0]; (a[1] = 4) + 1`, 5},
+		// the index is evaluated once
+		{`let i = 0; let next = fn() { i += 1; i }; let a = [0, 0, 0]; a[next()] += 5; [i, a[1]]`, []int{1, 5}},
+		{`let a = [1]; try { a[1] = 2 } catch (e) { e["message"] }`, "index out of range: 1"},
+		{`let a = [1, 2]; a[-1] = 5; a[1]`, 5},
+		{`let a = [1]; try { a[-2] = 2 } catch (e) { e["message"] }`, "index out of range: -2"},
+		{`try { "abc"[0] = "x" } catch (e) { e["message"] }`, "index assignment not supported: STRING"},
+		{`let h = {}; try { h[[1]] = 1 } catch (e) { e["message"] }`, "unusable as hash key: ARRAY"},
+		// captured variables are shared by the function and its closures
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c()`, 2},
+		{`let f = fn() { let c = 0; fn() { c += 1; c } }; let g = f(); g(); g()`, 2},
+		{`let f = fn() { let n = 1; let get = fn() { n }; n = 5; get() }; f()`, 5},
+		{`let f = fn() { let n = 1; let set = fn() { n = 7 }; set(); n }; f()`, 7},
+		{`let f = fn() { let n = 0; let inc = fn() { fn() { n += 1 } }; inc()(); inc()(); n }; f()`, 2},
+		{`let f = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let p = f(); p[0](); p[0](); p[1]()`, 2},
+		{`let f = fn() { let fs = []; let i = 0; while (i < 3) { let x = i; fs = push(fs, fn() { x }); i += 1 }; fs[0]() + fs[2]() }; f()`, 4},
+		{`try { y = 1 } catch (e) { e["message"] }`, "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let i = 0; while (i < 5) { let i = i + 1; }; i`, 5},
+		{`let i = 0; while (false) { let i = 1; }; i`, 0},
+		{`let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i`, 3},
+		{`
+		let i = 0;
+		let sum = 0;
+		while (i < 6) {
+			let i = i + 1;
+			if (i == 2) { continue; }
+			let sum = sum + i;
+		};
+		sum
+		`, 19},
+		{`let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum`, 6},
+		{`let sum = 0; for (x in []) { let sum = 1; }; sum`, 0},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{`let n = 0; for (k in {"a": 1, "b": 2}) { let n = n + 1; }; n`, 2},
+		{`let last = 0; for (x in [1, 2, 3, 4]) { if (x > 2) { break }; let last = x; }; last`, 2},
+		{`let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue }; let sum = sum + x; }; sum`, 8},
+		// nested loops, break and continue leave the inner one
+		{`
+		let count = 0;
+		for (x in [1, 2, 3]) {
+			for (y in [1, 2, 3]) {
+				if (y > x) { break; }
+				let count = count + 1;
+			}
+		};
+		count
+		`, 6},
+		// break out of an expression that already pushed values
+		{`
+		let sum = 0;
+		for (x in [1, 2, 3]) { let sum = sum + 10 * if (x == 2) { break } else { x }; };
+		sum
+		`, 10},
+		{`let sum = 0; for (x in [1, 2]) { let sum = sum + [x, if (x == 1) { continue } else { x }][1]; }; sum`, 2},
+		// loops in functions
+		{`
+		let find = fn(xs, limit) {
+			for (x in xs) {
+				if (x > limit) { return x; }
+			}
+			-1
+		};
+		[find([1, 5, 9], 4), find([1, 2], 4)]
+		`, []int{5, -1}},
+		{`
+		let count = fn(n) {
+			let i = 0;
+			while (i < n) { let i = i + 1; }
+			i
+		};
+		count(2000)
+		`, 2000},
+		{`let f = fn() { for (x in [1, 2]) { try { throw x } catch (e) { continue } }; 3 }; f()`, 3},
+		{`try { for (x in 5) {} } catch (e) { e["message"] }`, "not iterable: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+// testExpectedObject checks evaluated against an int, string or []int
+func testExpectedObject(t *testing.T, evaluated object.Object, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		testIntegerObject(t, evaluated, int64(expected))
+	case []int:
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			testIntegerObject(t, array.Elements[i], int64(el))
+		}
+	case *big.Int:
+		integer, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", evaluated, evaluated)
+			return
+		}
+		if integer.Value.Cmp(expected) != 0 {
+			t.Errorf("BigInt has wrong value. expected=%s, got=%s", expected, integer.Value)
+		}
+	case []string:
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, array.Elements[i], el)
+		}
+	case string:
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			return
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "math"; math.double(21)`, 42},
+		{`import "math" as m; m.pi`, 3},
+		{`import "math.mk"; math.pi`, 3},
+		{`import "my-lib" as lib; lib.x`, 1},
+		{`import "math"; math["pi"]`, 3},
+		// the globals of a module are its own
+		{`import "math"; let helper = 1; math.double(helper)`, 2},
+		{`let pi = 4; import "math"; [pi, math.pi]`, []int{4, 3}},
+		{`import "math"; let getPi = fn() { math.pi }; getPi()`, 3},
+		// imports are relative to the importing module
+		{`import "lib/strings"; strings.twice("ab")`, "abab"},
+		{`import "lib/strings"; strings.quad(1)`, 4},
+		// a module runs once, every import gets the same namespace
+		{`import "math" as a; import "math" as b; a == b`, true},
+		{`import "lib/strings"; import "math"; strings.quad(1) + math.pi`, 7},
+		{`import "bump"; import "bumpmore"; import "bump" as again; import "state"; state.counter["n"]`, 11},
+		{`import "math"; try { math.nope } catch (e) { e["message"] }`, "module math has no export nope"},
+		{`import "math"; try { math.pi = 4 } catch (e) { e["message"] }`, "index assignment not supported: MODULE"},
+		{`import "fails"`, "type mismatch: INTEGER + BOOLEAN"},
+		{`import "cycle_a"`, "import cycle: cycle_a.mk -> cycle_b.mk -> cycle_a.mk"},
+		{`import "nothere"`, "module not found: nothere.mk"},
+		{`import "broken"`, "broken.mk:1:9: no prefix parse function for ; found"},
+		{`import "undefined"; undefined.f()`, "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		env := object.NewEnvironment()
+		env.SetImports(object.NewImports(module.NewLoader([]string{dir})))
+		evaluated := Eval(p.ParseProgram(), env)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if !strings.HasSuffix(errObj.Message, tt.expected.(string)) {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if expected, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, expected)
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+// writeModules writes the modules the import tests use to a directory,
+// the tests find them in the search path
+func writeModules(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range testModules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write module: %s", err)
+		}
+	}
+	return dir
+}
+
+var testModules = map[string]string{
+	"math.mk": `
+	let helper = fn(x) { x * 2 };
+	export let double = fn(x) { helper(x) };
+	export let pi = 3;
+	`,
+	"lib/strings.mk": `
+	import "../math"
+	export let twice = fn(s) { s + s };
+	export let quad = fn(x) { math.double(math.double(x)) };
+	`,
+	"my-lib.mk":   `export let x = 1;`,
+	"state.mk":    `export let counter = {"n": 0};`,
+	"bump.mk":     `import "state"; state.counter["n"] += 1;`,
+	"bumpmore.mk": `import "state"; import "bump"; state.counter["n"] += 10;`,
+	"fails.mk":    `export let x = 1 + true;`,
+	"cycle_a.mk":  `import "cycle_b"`,
+	"cycle_b.mk":  `import "cycle_a"`,
+	"broken.mk":   `let x = ;`,
+	"undefined.mk": `
+	export let f = fn() { nope };
+	`,
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedInspect string
+	}{
+		{`throw "uncaught"`, "ERROR: 1:1: uncaught"},
+		{"let f = fn() {\n throw [1] }; f()", "ERROR: 2:2: [1]"},
+		{`let e = try { 1 + true } catch (e) { e }; throw e`, "ERROR: 1:17: type mismatch: INTEGER + BOOLEAN"},
+		{`try { 1 } catch (e) { 2 }; -true`, "ERROR: 1:28: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Caught {
+			t.Errorf("error for %q is marked as caught", tt.input)
+		}
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -402,6 +1263,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -417,6 +1286,38 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][5:]", []int{}},
+		{"[1, 2, 3][(1 << 64):]", []int{}},
+		{"let a = [1, 2, 3]; let b = a[:]; b[0] = 9; a[0]", 1},
+		{`"hällo"[1:3]`, "äl"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"monkey"[-1]`, "y"},
+		{`"abc"[5:]`, ""},
+		{`let s = "abcdef"; s[1:len(s) - 1]`, "bcde"},
+		{`try { [1][1:"x"] } catch (e) { e["message"] }`, "slice index must be INTEGER, got STRING"},
+		{`try { {}[1:] } catch (e) { e["message"] }`, "slice operator not supported: HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestHashLiteral(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -443,14 +1344,14 @@ func TestHashLiteral(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Pairs() {
+		expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Errorf("unexpected key in Pairs: %s", pair.Key.Inspect())
 		}
 
 		testIntegerObject(t, pair.Value, expectedValue)
@@ -490,6 +1391,14 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.5: 5}[2.5]`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -520,6 +1429,20 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -542,6 +1465,14 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+func bigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer " + s)
+	}
+	return v
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
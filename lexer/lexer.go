@@ -1,37 +1,70 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+
+	file   string // name of the source file, may be empty
+	line   int    // line of the current char
+	column int    // column of the current char, counted in runes
+
+	// braces holds the number of open braces of every ${ we are in,
+	// the } that closes the ${ continues the string
+	braces []int
 }
 
-// readChar gives us the next char from the input while keeping track of the position
+// readChar gives us the next char from the input while keeping track of the position,
+// the input is decoded as UTF-8 and invalid bytes become utf8.RuneError
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
+	size := 0
 	if l.readPosition >= len(l.input) { // end of input
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition] // current char = next position
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:]) // current char = next position
 	}
 	l.position = l.readPosition // update current
-	l.readPosition += 1         // incr. next reading position
+	l.readPosition += size      // incr. next reading position
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile("", input)
+}
+
+// NewWithFile returns a lexer whose token positions refer to file
+func NewWithFile(file, input string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
 	return l
 }
 
+// pos is the position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	// skip whitespace
 	l.skipWhitespace()
+	pos := l.pos()
 
 	switch l.ch {
 	// if l.ch is not one of the single letter tokens, we call function readIdentifier
@@ -39,13 +72,14 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = token.Token{Type: token.ILLEGAL, Literal: fmt.Sprintf("illegal character %q", l.ch)}
 		}
 	// check for EQ token
 	case '=':
@@ -60,8 +94,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringToken(token.STRING, token.STRING_HEAD)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -70,18 +103,43 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '{':
+		if n := len(l.braces); n > 0 {
+			l.braces[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.braces)
+		if n > 0 && l.braces[n-1] == 0 {
+			// the end of a ${...}
+			l.braces = l.braces[:n-1]
+			tok = l.readStringToken(token.STRING_TAIL, token.STRING_MIDDLE)
+			break
+		}
+		if n > 0 {
+			l.braces[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case '!':
@@ -97,10 +155,46 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		case '<':
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: "<<"}
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		case '>':
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: ">>"}
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
 	case '\n':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case 0:
@@ -109,10 +203,11 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -126,20 +221,49 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter accepts unicode letters, ä and λ are fine in identifiers
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float, a float has a fraction (3.14) or
+// an exponent (1e-9) or both. The '.' only belongs to the number when a digit
+// follows it, so 1.foo still lexes as 1 . foo
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		// the exponent needs at least one digit, optionally after a sign
+		n := 1
+		if c := l.peekCharAt(1); c == '+' || c == '-' {
+			n = 2
+		}
+		if isDigit(l.peekCharAt(n)) {
+			tokenType = token.FLOAT
+			for i := 0; i < n; i++ {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -149,22 +273,117 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // peekChar looks at the next char without incrementing the positions
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	return l.peekCharAt(1)
+}
+
+// peekCharAt looks n chars ahead, peekCharAt(1) is the same as peekChar
+func (l *Lexer) peekCharAt(n int) rune {
+	pos := l.readPosition
+	for ; n > 1 && pos < len(l.input); n-- {
+		_, size := utf8.DecodeRuneInString(l.input[pos:])
+		pos += size
+	}
+	if pos >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[pos:])
+	return ch
 }
 
 // Strings
-func (l *Lexer) readString() string {
-	position := l.position + 1 // skip opening "
+
+// readStringToken reads the string after l.ch, which is the opening " or
+// the } of an interpolation. The token is end when the string ends with ",
+// interpolation when it stops at a ${
+func (l *Lexer) readStringToken(end, interpolation token.TokenType) token.Token {
+	literal, interpolated, err := l.readString()
+	if interpolated {
+		l.braces = append(l.braces, 0)
+	}
+	switch {
+	case err != nil:
+		return token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+	case interpolated:
+		return token.Token{Type: interpolation, Literal: literal}
+	default:
+		return token.Token{Type: end, Literal: literal}
+	}
+}
+
+// readString reads a string literal and replaces its escape sequences:
+// \n \t \r \" \\ \$ and \u{...} with the hex code point of a unicode char.
+// It stops at the closing " or after the ${ of an interpolation, then
+// interpolated is true.
+// A bad escape doesn't stop the string, so the lexer carries on after it.
+func (l *Lexer) readString() (literal string, interpolated bool, err error) {
+	var out strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '"':
+			return out.String(), false, err
+		case 0:
+			return "", false, fmt.Errorf("unterminated string")
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				break
+			}
+			l.readChar()
+			return out.String(), true, err
+		case '\\':
+			l.readChar()
+			ch, escErr := l.readEscape()
+			if escErr != nil && err == nil {
+				err = escErr
+			}
+			out.WriteRune(ch)
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
-	return l.input[position:l.position]
+}
+
+// readEscape reads the escape sequence after a backslash, l.ch is left on
+// its last char
+func (l *Lexer) readEscape() (rune, error) {
+	switch l.ch {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case '$':
+		return '$', nil
+	case 'u':
+		if l.peekChar() != '{' {
+			return utf8.RuneError, fmt.Errorf("invalid unicode escape, want \\u{...}")
+		}
+		l.readChar()
+		start := l.readPosition
+		for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		hex := l.input[start:l.readPosition]
+		if l.peekChar() != '}' {
+			return utf8.RuneError, fmt.Errorf("invalid unicode escape \\u{%s", hex)
+		}
+		l.readChar()
+		value, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(value)) {
+			return utf8.RuneError, fmt.Errorf("invalid unicode escape \\u{%s}", hex)
+		}
+		return rune(value), nil
+	case 0:
+		// readString reports the missing closing quote
+		return 0, nil
+	default:
+		return utf8.RuneError, fmt.Errorf("invalid escape sequence \\%c", l.ch)
+	}
 }
@@ -30,6 +30,11 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+try { throw x } catch (e) {}
+while for in break continue
+x += 1 -= 2
+<= >= % && || & | ^ << >>
+3.14 1e-9 2.5E+3 7e
 `
 
 	tests := []struct {
@@ -122,6 +127,42 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.THROW, "throw"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.PERCENT, "%"},
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.BIT_AND, "&"},
+		{token.BIT_OR, "|"},
+		{token.BIT_XOR, "^"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
 		{token.EOF, ""},
 	}
 
@@ -141,3 +182,145 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a\nb\";\n\tfn"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a\nb", 2, 7},
+		{";", 3, 3},
+		{"fn", 4, 2},
+		{"", 4, 4},
+	}
+
+	l := NewWithFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		expected := token.Position{File: "test.mk", Line: tt.expectedLine, Column: tt.expectedColumn}
+		if tok.Pos != expected {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%s, got=%s",
+				i, tok.Literal, expected, tok.Pos)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"\t\r"`, token.STRING, "\t\r"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{1F600} \u{e4}"`, token.STRING, "\U0001F600 ä"},
+		{`"日本語"`, token.STRING, "日本語"},
+		{`"\q"`, token.ILLEGAL, `invalid escape sequence \q`},
+		{`"\u{}"`, token.ILLEGAL, `invalid unicode escape \u{}`},
+		{`"\u{D800}"`, token.ILLEGAL, `invalid unicode escape \u{D800}`},
+		{`"\u41"`, token.ILLEGAL, `invalid unicode escape, want \u{...}`},
+		{`"abc`, token.ILLEGAL, "unterminated string"},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let größe = \"ü\"; λ + _x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "ü", 13},
+		{token.SEMICOLON, ";", 16},
+		{token.IDENT, "λ", 18},
+		{token.PLUS, "+", 20},
+		{token.IDENT, "_x", 22},
+		{token.EOF, "", 24},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - column of %q wrong. expected=%d, got=%d",
+				i, tok.Literal, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestInterpolationTokens(t *testing.T) {
+	input := `"a${x}b${ {1: "}"}[1] }c" "$ \${}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "a"},
+		{token.IDENT, "x"},
+		{token.STRING_MIDDLE, "b"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.STRING_TAIL, "c"},
+		{token.STRING, "$ ${}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -1,19 +1,164 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"monkey/repl"
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
+// exit codes of the monkey command
+const (
+	exitOK           = 0
+	exitRuntimeError = 1 // the program failed while running
+	exitUsage        = 2 // bad command line, unreadable files
+	exitParseError   = 3
+	exitCompileError = 4
+)
+
+const usage = `Usage:
+  monkey [flags]                        start the REPL
+  monkey [flags] repl                   start the REPL
+  monkey [flags] run FILE [ARGS...]     run the script FILE, ARGS are available as the array "args"
+  monkey [flags] build FILE [-o OUT]    compile the script FILE to bytecode, OUT defaults to FILE with the extension .mkc
+  monkey [flags] exec FILE [ARGS...]    run the bytecode FILE written by build, always in the vm
+  monkey [flags] disasm FILE            list the bytecode of the script or bytecode FILE
+
+Flags:
+`
+
 func main() {
+	os.Exit(monkey(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// monkey runs the command line args and returns the exit code
+func monkey(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	engine := engineFlag(flags, repl.EngineVM)
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		return startRepl(stdin, stdout, *engine)
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+
+	// subcommands accept the flags after their name as well
+	sub := flag.NewFlagSet("monkey "+command, flag.ContinueOnError)
+	sub.SetOutput(stderr)
+	sub.Usage = flags.Usage
+	engine = engineFlag(sub, *engine)
+	var output *string
+	if command == "build" {
+		output = sub.String("o", "", "output file of build")
+	}
+	if err := sub.Parse(rest); err != nil {
+		return exitUsage
+	}
+	if *engine != repl.EngineVM && *engine != repl.EngineEval {
+		fmt.Fprintf(stderr, "monkey: unknown engine %q, want %q or %q\n",
+			*engine, repl.EngineVM, repl.EngineEval)
+		return exitUsage
+	}
+
+	switch command {
+	case "repl":
+		return startRepl(stdin, stdout, *engine)
+	case "run":
+		if sub.NArg() < 1 {
+			fmt.Fprintln(stderr, "monkey run: missing script file")
+			flags.Usage()
+			return exitUsage
+		}
+		return runFile(sub.Arg(0), sub.Args()[1:], *engine, stdout, stderr)
+	case "build":
+		if sub.NArg() < 1 {
+			fmt.Fprintln(stderr, "monkey build: missing script file")
+			flags.Usage()
+			return exitUsage
+		}
+		// -o may follow the script file
+		path := sub.Arg(0)
+		if err := sub.Parse(sub.Args()[1:]); err != nil {
+			return exitUsage
+		}
+		if sub.NArg() != 0 {
+			fmt.Fprintf(stderr, "monkey build: unexpected arguments %q\n", sub.Args())
+			flags.Usage()
+			return exitUsage
+		}
+		return buildFile(path, *output, stderr)
+	case "exec":
+		if sub.NArg() < 1 {
+			fmt.Fprintln(stderr, "monkey exec: missing bytecode file")
+			flags.Usage()
+			return exitUsage
+		}
+		return execFile(sub.Arg(0), sub.Args()[1:], stdout, stderr)
+	case "disasm":
+		if sub.NArg() != 1 {
+			fmt.Fprintln(stderr, "monkey disasm: want exactly one file")
+			flags.Usage()
+			return exitUsage
+		}
+		return disasmFile(sub.Arg(0), stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "monkey: unknown command %q\n", command)
+		flags.Usage()
+		return exitUsage
+	}
+}
+
+func engineFlag(flags *flag.FlagSet, value string) *string {
+	return flags.String("engine", value, "backend to execute with: vm or eval")
+}
+
+func startRepl(stdin io.Reader, stdout io.Writer, engine string) int {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the interpreter programming language!\n",
+	fmt.Fprintf(stdout, "Hello %s! This is the interpreter programming language!\n",
 		user.Username)
-	fmt.Printf("")
-	repl.Start(os.Stdin, os.Stdout)
+
+	if !isTerminal(stdin) {
+		repl.Start(stdin, stdout, engine)
+		return exitOK
+	}
+
+	terminal := repl.NewTerminal(historyPath(user.HomeDir))
+	defer terminal.Close()
+	repl.Run(terminal, stdout, engine)
+	return exitOK
+}
+
+// historyPath is $MONKEY_HISTORY or ~/.monkey_history
+func historyPath(home string) string {
+	if path, ok := os.LookupEnv("MONKEY_HISTORY"); ok {
+		return path
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
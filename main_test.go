@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, source string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatalf("could not write script: %s", err)
+	}
+	return path
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		source         string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			source: `
+			let greet = fn(name) {
+				"hello " + name;
+			};
+			puts(greet(first(args)));
+			`,
+			args:           []string{"world"},
+			expectedCode:   exitOK,
+			expectedStdout: "hello world\n",
+		},
+		{
+			source:         `puts(len(args), args)`,
+			args:           []string{"a", "b", "c"},
+			expectedCode:   exitOK,
+			expectedStdout: "3\n[a,b,c]\n",
+		},
+		{
+			// builtins that call functions print to the same output
+			source:         `map([1, 2], puts); puts("done")`,
+			expectedCode:   exitOK,
+			expectedStdout: "1\n2\ndone\n",
+		},
+		{
+			source:         `puts("before"); 1 + true; puts("after")`,
+			expectedCode:   exitRuntimeError,
+			expectedStdout: "before\n",
+			expectedStderr: "ERROR:",
+		},
+		{
+			source:         `let x = ;`,
+			expectedCode:   exitParseError,
+			expectedStderr: "no prefix parse function for ; found",
+		},
+		{
+			source:         `1 + true`,
+			expectedCode:   exitRuntimeError,
+			expectedStderr: "ERROR:",
+		},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			path := writeScript(t, tt.source)
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-engine=" + engine, "run", path}, tt.args...)
+			code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.expectedCode {
+				t.Errorf("[%s] wrong exit code for %q. want=%d, got=%d (stderr=%q)",
+					engine, tt.source, tt.expectedCode, code, stderr.String())
+			}
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("[%s] wrong stdout for %q. want=%q, got=%q",
+					engine, tt.source, tt.expectedStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedStderr) {
+				t.Errorf("[%s] stderr does not contain %q. got=%q",
+					engine, tt.expectedStderr, stderr.String())
+			}
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		source         string
+		engine         string
+		expectedStderr string
+	}{
+		{"let x = 1;\nlet y 2;", "vm", "script.mk:2:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\n  z", "vm", "script.mk:2:3: undefined variable z"},
+		{"let x = 1;\n  x + true", "eval", "script.mk:2:5: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() {\n  1 + true };\nf()", "vm", "at f ("},
+		{"let f = fn() {\n  1 + true };\nf()", "vm", "script.mk:2:5)\n"},
+		{"let f = fn() {\n  1 + true };\nf()", "vm", "script.mk:3:2)\n"},
+	}
+
+	for _, tt := range tests {
+		path := writeScript(t, tt.source)
+
+		var stdout, stderr bytes.Buffer
+		monkey([]string{"-engine=" + tt.engine, "run", path}, strings.NewReader(""), &stdout, &stderr)
+
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("[%s] stderr does not contain %q. got=%q",
+				tt.engine, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestRunImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/math.mk":  `export let double = fn(x) { x * 2 };`,
+		"path/util.mk": `import "math"; export let quad = fn(x) { math.double(math.double(x)) };`,
+		"path/math.mk": `export let double = fn(x) { x + x };`,
+		"cycle.mk":     `import "main"`,
+		"broken.mk":    `import "nothere"`,
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write module: %s", err)
+		}
+	}
+	t.Setenv("MONKEY_PATH", filepath.Join(dir, "path"))
+
+	tests := []struct {
+		source         string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		// lib/math.mk is next to the script, util.mk in $MONKEY_PATH
+		{`import "lib/math"; import "util"; puts(math.double(2), util.quad(1))`, exitOK, "4\n4\n", ""},
+		{`import "nothere"`, exitCompileError, "", "main.mk:1:1: module not found: nothere.mk"},
+		{`import "cycle"`, exitCompileError, "", "import cycle: main.mk -> cycle.mk -> main.mk"},
+		{`import "broken"`, exitCompileError, "", "broken.mk:1:1: module not found: nothere.mk"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			path := filepath.Join(dir, "main.mk")
+			if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+				t.Fatalf("could not write script: %s", err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := monkey([]string{"-engine=" + engine, "run", path}, strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.expectedCode {
+				t.Errorf("[%s] wrong exit code for %q. want=%d, got=%d (stderr=%q)",
+					engine, tt.source, tt.expectedCode, code, stderr.String())
+			}
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("[%s] wrong stdout for %q. want=%q, got=%q",
+					engine, tt.source, tt.expectedStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedStderr) {
+				t.Errorf("[%s] stderr does not contain %q. got=%q",
+					engine, tt.expectedStderr, stderr.String())
+			}
+		}
+	}
+}
+
+func TestBuildAndExec(t *testing.T) {
+	tests := []struct {
+		source         string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+	}{
+		{
+			source: `
+			let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+			puts(fib(10))
+			`,
+			expectedCode:   exitOK,
+			expectedStdout: "55\n",
+		},
+		{
+			source:         `puts(len(first(args)))`,
+			args:           []string{"monkey"},
+			expectedCode:   exitOK,
+			expectedStdout: "6\n",
+		},
+		{
+			source:       `first(args) + 1`,
+			args:         []string{"gorillas"},
+			expectedCode: exitRuntimeError,
+		},
+	}
+
+	for _, tt := range tests {
+		path := writeScript(t, tt.source)
+		output := filepath.Join(t.TempDir(), "out.mkc")
+
+		var stdout, stderr bytes.Buffer
+		code := monkey([]string{"build", path, "-o", output}, strings.NewReader(""), &stdout, &stderr)
+		if code != exitOK {
+			t.Fatalf("build failed for %q. got=%d (stderr=%q)", tt.source, code, stderr.String())
+		}
+
+		stdout.Reset()
+		args := append([]string{"exec", output}, tt.args...)
+		code = monkey(args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d (stderr=%q)",
+				tt.source, tt.expectedCode, code, stderr.String())
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("wrong stdout for %q. want=%q, got=%q", tt.source, tt.expectedStdout, stdout.String())
+		}
+	}
+}
+
+func TestBuildDefaultOutput(t *testing.T) {
+	path := writeScript(t, `let x = 1;`)
+
+	var stdout, stderr bytes.Buffer
+	code := monkey([]string{"build", path}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("build failed. got=%d (stderr=%q)", code, stderr.String())
+	}
+
+	expected := strings.TrimSuffix(path, ".mk") + ".mkc"
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("expected build to write %s: %s", expected, err)
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	path := writeScript(t, `let add = fn(a, b) { a + b }; puts(add(1, 2));`)
+	output := filepath.Join(t.TempDir(), "out.mkc")
+
+	var stdout, stderr bytes.Buffer
+	if code := monkey([]string{"build", path, "-o", output}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("build failed. got=%d (stderr=%q)", code, stderr.String())
+	}
+
+	expected := []string{
+		"0000 COMPILED_FUNCTION_OBJ add params=2 locals=2",
+		"; add",
+		"; puts",
+		"add: params=2 locals=2",
+	}
+
+	// a script is compiled first, a bytecode file is listed as it is
+	for _, file := range []string{path, output} {
+		var stdout, stderr bytes.Buffer
+		code := monkey([]string{"disasm", file}, strings.NewReader(""), &stdout, &stderr)
+		if code != exitOK {
+			t.Fatalf("disasm %s failed. got=%d (stderr=%q)", file, code, stderr.String())
+		}
+
+		for _, want := range expected {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("disasm %s does not contain %q. got=\n%s", file, want, stdout.String())
+			}
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{"run"},
+		{"unknown"},
+		{"-engine=foo", "repl"},
+		{"run", "does/not/exist.mk"},
+		{"build"},
+		{"build", "a.mk", "b.mk"},
+		{"exec"},
+		{"exec", "does/not/exist.mkc"},
+		{"disasm"},
+		{"disasm", "does/not/exist.mk"},
+	}
+
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+		if code != exitUsage {
+			t.Errorf("wrong exit code for %v. want=%d, got=%d", args, exitUsage, code)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package module finds and parses the files of import statements. The
+// evaluator and the compiler both load modules through a Loader, each of
+// them caches what it made from a module on its own.
+package module
+
+import (
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ext is the extension of Monkey files, import paths may leave it out
+const Ext = ".mk"
+
+// Loader resolves import paths to files and parses them. It remembers the
+// modules that are being loaded, so an import cycle is an error instead of
+// an endless loop.
+type Loader struct {
+	// SearchPath are the directories a relative import is looked up in when
+	// it isn't next to the importing file
+	SearchPath []string
+
+	loading []string // files of the modules being loaded, innermost last
+}
+
+func NewLoader(searchPath []string) *Loader {
+	return &Loader{SearchPath: searchPath}
+}
+
+// SearchPathFromEnv splits $MONKEY_PATH into directories like $PATH
+func SearchPathFromEnv() []string {
+	return filepath.SplitList(os.Getenv("MONKEY_PATH"))
+}
+
+// Resolve returns the absolute file an import of path in the file from
+// refers to. A relative path is looked up next to from first, the working
+// directory when from is empty, and in the search path after that.
+func (l *Loader) Resolve(path, from string) (string, error) {
+	if filepath.Ext(path) == "" {
+		path += Ext
+	}
+
+	dirs := []string{""}
+	if !filepath.IsAbs(path) {
+		dirs = append([]string{filepath.Dir(from)}, l.SearchPath...)
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, path)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return filepath.Abs(file)
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", path)
+}
+
+// Load parses file, which came from Resolve. The module counts as loading
+// until Done is called, importing it again before that is a cycle.
+func (l *Loader) Load(file string) (*ast.Program, error) {
+	for i, loading := range l.loading {
+		if loading == file {
+			cycle := []string{}
+			for _, f := range l.loading[i:] {
+				cycle = append(cycle, filepath.Base(f))
+			}
+			cycle = append(cycle, filepath.Base(file))
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.NewWithFile(file, string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	l.loading = append(l.loading, file)
+	return program, nil
+}
+
+// Enter marks the script in file as loading. The imports of a script start
+// there, so a module importing the script again is a cycle as well.
+func (l *Loader) Enter(file string) {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	l.loading = append(l.loading, file)
+}
+
+// Done ends the innermost Load
+func (l *Loader) Done() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Name is the name of the module in file, its file name without extension
+func Name(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+}
+
+// Exports returns the names a module exports, in the order it exports them
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			names = append(names, export.Statement.Name.Value)
+		}
+	}
+	return names
+}
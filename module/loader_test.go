@@ -0,0 +1,134 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write module: %s", err)
+		}
+	}
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mk":         ``,
+		"util.mk":         ``,
+		"lib/util.mk":     ``,
+		"lib/strings.mk":  ``,
+		"path/strings.mk": ``,
+		"path/extra.mk":   ``,
+		"data.txt":        ``,
+	})
+	loader := NewLoader([]string{filepath.Join(dir, "path")})
+
+	tests := []struct {
+		path     string
+		from     string
+		expected string
+	}{
+		{"util", "main.mk", "util.mk"},
+		{"util.mk", "main.mk", "util.mk"},
+		{"lib/util", "main.mk", "lib/util.mk"},
+		// next to the importer first, the search path after that
+		{"util", "lib/strings.mk", "lib/util.mk"},
+		{"strings", "lib/main.mk", "lib/strings.mk"},
+		{"strings", "main.mk", "path/strings.mk"},
+		{"extra", "lib/strings.mk", "path/extra.mk"},
+		{"../util", "lib/strings.mk", "util.mk"},
+		{"data.txt", "main.mk", "data.txt"},
+		{filepath.Join(dir, "lib/util"), "main.mk", "lib/util.mk"},
+	}
+
+	for _, tt := range tests {
+		file, err := loader.Resolve(tt.path, filepath.Join(dir, tt.from))
+		if err != nil {
+			t.Errorf("could not resolve %q from %q: %s", tt.path, tt.from, err)
+			continue
+		}
+		if expected := filepath.Join(dir, tt.expected); file != expected {
+			t.Errorf("wrong file for %q from %q. want=%q, got=%q", tt.path, tt.from, expected, file)
+		}
+	}
+
+	_, err := loader.Resolve("lib", filepath.Join(dir, "main.mk"))
+	if err == nil || err.Error() != "module not found: lib.mk" {
+		t.Errorf("wrong error for a missing module. got=%v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"math.mk":   "let helper = 1;\nexport let pi = 3;\nexport let double = fn(x) { x * 2 };",
+		"broken.mk": "let x = ;\nlet y 1;",
+	})
+	loader := NewLoader(nil)
+
+	math := filepath.Join(dir, "math.mk")
+	program, err := loader.Load(math)
+	if err != nil {
+		t.Fatalf("could not load math.mk: %s", err)
+	}
+	loader.Done()
+
+	exports := Exports(program)
+	if strings.Join(exports, " ") != "pi double" {
+		t.Errorf("wrong exports. got=%q", exports)
+	}
+	if name := Name(math); name != "math" {
+		t.Errorf("wrong name. want=%q, got=%q", "math", name)
+	}
+
+	_, err = loader.Load(filepath.Join(dir, "broken.mk"))
+	if err == nil {
+		t.Fatalf("expected parser errors for broken.mk")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "broken.mk:1:9: no prefix parse function for ; found") {
+		t.Errorf("wrong parser errors. got=%q", err)
+	}
+}
+
+func TestLoadCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mk": ``,
+		"a.mk":    ``,
+		"b.mk":    ``,
+	})
+	loader := NewLoader(nil)
+	loader.Enter(filepath.Join(dir, "main.mk"))
+
+	for _, name := range []string{"a.mk", "b.mk"} {
+		if _, err := loader.Load(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("could not load %s: %s", name, err)
+		}
+	}
+
+	_, err := loader.Load(filepath.Join(dir, "a.mk"))
+	if err == nil || err.Error() != "import cycle: a.mk -> b.mk -> a.mk" {
+		t.Errorf("wrong error for a cycle. got=%v", err)
+	}
+	_, err = loader.Load(filepath.Join(dir, "main.mk"))
+	if err == nil || err.Error() != "import cycle: main.mk -> a.mk -> b.mk -> main.mk" {
+		t.Errorf("wrong error for a cycle through the script. got=%v", err)
+	}
+
+	// a module that was loaded before isn't a cycle
+	loader.Done()
+	if _, err := loader.Load(filepath.Join(dir, "b.mk")); err != nil {
+		t.Errorf("could not load b.mk again: %s", err)
+	}
+}
@@ -0,0 +1,214 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// BigInt is an integer that doesn't fit into an int64. Integer arithmetic
+// promotes to BigInt when it overflows and results that fit into an int64
+// again are Integers, so Monkey code only ever sees INTEGER.
+type BigInt struct {
+	Value *big.Int
+}
+
+// MaxShift limits << on integers, 1 << MaxShift is already a 128 KiB number
+const MaxShift = 1 << 20
+
+func (b *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// a BigInt never has the value of an Integer, so its hash only needs to be
+// the same for BigInts of the same value
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// NewInteger returns v as an Integer when it fits into an int64, as a
+// BigInt otherwise
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// BigValue returns the value of an Integer or a BigInt as a big.Int,
+// false for anything else. The result may be shared with obj.
+func BigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+// IntegerFromFloat truncates f towards zero, false for NaN and infinities
+func IntegerFromFloat(f float64) (Object, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, false
+	}
+	if f >= math.MinInt64 && f < math.MaxInt64 {
+		return &Integer{Value: int64(f)}, true
+	}
+	v, _ := big.NewFloat(f).Int(nil)
+	return NewInteger(v), true
+}
+
+// AddInt64, SubInt64 and MulInt64 do the int64 arithmetic,
+// false when the result overflows
+
+func AddInt64(a, b int64) (int64, bool) {
+	r := a + b
+	return r, (a^r)&(b^r) >= 0
+}
+
+func SubInt64(a, b int64) (int64, bool) {
+	r := a - b
+	return r, (a^b)&(a^r) >= 0
+}
+
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	r := a * b
+	if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return r, false
+	}
+	return r, true
+}
+
+// IntegerOperation applies the arithmetic or bitwise operator to two
+// integers. It works on int64 as long as the result fits and falls back to
+// math/big when it doesn't.
+func IntegerOperation(operator string, left, right Object) (Object, error) {
+	leftInt, leftOk := left.(*Integer)
+	rightInt, rightOk := right.(*Integer)
+	if !leftOk || !rightOk {
+		return bigIntegerOperation(operator, left, right)
+	}
+	leftValue := leftInt.Value
+	rightValue := rightInt.Value
+
+	var result int64
+	ok := true
+
+	switch operator {
+	case "+":
+		result, ok = AddInt64(leftValue, rightValue)
+	case "-":
+		result, ok = SubInt64(leftValue, rightValue)
+	case "*":
+		result, ok = MulInt64(leftValue, rightValue)
+	case "/":
+		if rightValue == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// the only int64 division that overflows
+		ok = leftValue != math.MinInt64 || rightValue != -1
+		result = leftValue / rightValue
+	case "%":
+		if rightValue == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = leftValue % rightValue
+	case "&":
+		result = leftValue & rightValue
+	case "|":
+		result = leftValue | rightValue
+	case "^":
+		result = leftValue ^ rightValue
+	case "<<", ">>":
+		if rightValue < 0 {
+			return nil, fmt.Errorf("negative shift count: %d", rightValue)
+		}
+		if operator == "<<" {
+			result = leftValue << rightValue
+			ok = rightValue < 64 && result>>rightValue == leftValue
+		} else {
+			result = leftValue >> rightValue
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+	if !ok {
+		// the result overflowed int64
+		return bigIntegerOperation(operator, left, right)
+	}
+	return &Integer{Value: result}, nil
+}
+
+// bigIntegerOperation is the math/big version of IntegerOperation, results
+// that fit into an int64 are Integers again
+func bigIntegerOperation(operator string, left, right Object) (Object, error) {
+	leftValue, _ := BigValue(left)
+	rightValue, _ := BigValue(right)
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		result.Add(leftValue, rightValue)
+	case "-":
+		result.Sub(leftValue, rightValue)
+	case "*":
+		result.Mul(leftValue, rightValue)
+	case "/", "%":
+		if rightValue.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// Quo and Rem truncate like Go's / and %
+		if operator == "/" {
+			result.Quo(leftValue, rightValue)
+		} else {
+			result.Rem(leftValue, rightValue)
+		}
+	case "&":
+		result.And(leftValue, rightValue)
+	case "|":
+		result.Or(leftValue, rightValue)
+	case "^":
+		result.Xor(leftValue, rightValue)
+	case "<<", ">>":
+		if rightValue.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count: %s", right.Inspect())
+		}
+		if operator == ">>" {
+			// shifting out every bit leaves 0 or -1
+			shift := uint(leftValue.BitLen() + 1)
+			if rightValue.IsInt64() && rightValue.Int64() < int64(shift) {
+				shift = uint(rightValue.Int64())
+			}
+			result.Rsh(leftValue, shift)
+			break
+		}
+		if !rightValue.IsInt64() || rightValue.Int64() > MaxShift {
+			return nil, fmt.Errorf("shift count too large: %s", right.Inspect())
+		}
+		result.Lsh(leftValue, uint(rightValue.Int64()))
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+	return NewInteger(result), nil
+}
+
+// NegateInteger returns -obj for an Integer or a BigInt, -math.MinInt64
+// doesn't fit into an int64 and is a BigInt
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	v, _ := BigValue(obj)
+	return NewInteger(new(big.Int).Neg(v))
+}
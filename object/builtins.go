@@ -0,0 +1,937 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins is the table of builtin functions shared by the evaluator and the vm.
+// The compiler refers to a builtin by its index, so new builtins are appended
+// at the end.
+//
+// A builtin returns nil when it has nothing to return, the backends turn that
+// into their own Null.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *String:
+					// strings count code points, not bytes
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *Hash:
+					return &Integer{Value: int64(arg.Len())}
+				default:
+					return newError("argument to `len` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"first",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// check number of arguments
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// check array type
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"last",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// check number of arguments
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				// check array type
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"rest",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `rest` must be ARRAY, got %s",
+						args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElements := make([]Object, length-1, length-1)
+					copy(newElements, arr.Elements[1:length])
+					return &Array{Elements: newElements}
+				}
+
+				return nil
+			},
+		},
+	},
+	// TODO: turn this into a push for a list of objects
+	{
+		"push",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=%d",
+						len(args),
+						2,
+					)
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `push` must be ARRAY, got %s",
+						args[0].Type(),
+					)
+				}
+				// don't need to check for second input type since array can store multilpe
+				// elements of different types
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+
+				newElements := make([]Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
+
+				return &Array{Elements: newElements}
+			},
+		},
+	},
+	{
+		"puts",
+		&Builtin{
+			Output: func(out io.Writer, args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(out, arg.Inspect())
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					return arg
+				case *Float:
+					// truncates towards zero like Go does
+					value, ok := IntegerFromFloat(arg.Value)
+					if !ok {
+						return newError("cannot convert %s to INTEGER", arg.Inspect())
+					}
+					return value
+				case *String:
+					value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+					if !ok {
+						return newError("could not parse %q as integer", arg.Value)
+					}
+					return NewInteger(value)
+				default:
+					return newError("argument to `int` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					value, _ := FloatValue(arg)
+					return &Float{Value: value}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("could not parse %q as float", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"format",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 {
+					return newError("wrong number of arguments. got=%d, want at least 1",
+						len(args))
+				}
+				format, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `format` must be STRING, got %s",
+						args[0].Type())
+				}
+
+				result, err := formatString(format.Value, args[1:])
+				if err != nil {
+					return newError("%s", err)
+				}
+				return &String{Value: result}
+			},
+		},
+	},
+	{
+		"split",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("split", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				// an empty separator splits after every code point
+				parts := strings.Split(args[0].(*String).Value, args[1].(*String).Value)
+				return stringArray(parts)
+			},
+		},
+	},
+	{
+		"join",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("join", args, ARRAY_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				// elements that aren't strings are joined like puts prints them
+				elements := args[0].(*Array).Elements
+				parts := make([]string, len(elements))
+				for i, el := range elements {
+					parts[i] = el.Inspect()
+				}
+				return &String{Value: strings.Join(parts, args[1].(*String).Value)}
+			},
+		},
+	},
+	{
+		"trim",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("trim", args, STRING_OBJ); err != nil {
+					return err
+				}
+				return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"upper",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("upper", args, STRING_OBJ); err != nil {
+					return err
+				}
+				return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"lower",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("lower", args, STRING_OBJ); err != nil {
+					return err
+				}
+				return &String{Value: strings.ToLower(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"replace",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("replace", args, STRING_OBJ, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				return &String{Value: strings.ReplaceAll(args[0].(*String).Value,
+					args[1].(*String).Value, args[2].(*String).Value)}
+			},
+		},
+	},
+	{
+		"contains",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// contains(s, sub) for strings, contains(arr, x) for arrays
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2",
+						len(args))
+				}
+
+				switch container := args[0].(type) {
+				case *String:
+					if err := checkArgs("contains", args, STRING_OBJ, STRING_OBJ); err != nil {
+						return err
+					}
+					return NativeBool(strings.Contains(container.Value, args[1].(*String).Value))
+				case *Array:
+					for _, el := range container.Elements {
+						if Equal(el, args[1]) {
+							return True
+						}
+					}
+					return False
+				default:
+					return newError("argument 1 to `contains` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"starts_with",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("starts_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				return NativeBool(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"ends_with",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("ends_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				return NativeBool(strings.HasSuffix(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"index_of",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("index_of", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+				// the index counts code points like indexing does, -1 when it's missing
+				str := args[0].(*String).Value
+				i := strings.Index(str, args[1].(*String).Value)
+				if i > 0 {
+					i = utf8.RuneCountInString(str[:i])
+				}
+				return &Integer{Value: int64(i)}
+			},
+		},
+	},
+	{
+		"substr",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// substr(s, start) or substr(s, start, length), in code points
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=2 or 3",
+						len(args))
+				}
+				types := []ObjectType{STRING_OBJ, INTEGER_OBJ, INTEGER_OBJ}
+				if err := checkArgs("substr", args, types[:len(args)]...); err != nil {
+					return err
+				}
+
+				runes := []rune(args[0].(*String).Value)
+				start, ok := smallInt(args[1])
+				if !ok || start < 0 || start > int64(len(runes)) {
+					return newError("argument 2 to `substr` must be between 0 and %d, got %s",
+						len(runes), args[1].Inspect())
+				}
+				end := int64(len(runes))
+				if len(args) == 3 {
+					length, ok := smallInt(args[2])
+					if v, _ := BigValue(args[2]); v.Sign() < 0 {
+						return newError("argument 3 to `substr` must not be negative, got %s",
+							args[2].Inspect())
+					}
+					// a length past the end stops at the end
+					if ok && length < end-start {
+						end = start + length
+					}
+				}
+				return &String{Value: string(runes[start:end])}
+			},
+		},
+	},
+	{
+		"repeat",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("repeat", args, STRING_OBJ, INTEGER_OBJ); err != nil {
+					return err
+				}
+				str := args[0].(*String).Value
+				count, ok := smallInt(args[1])
+				if v, _ := BigValue(args[1]); v.Sign() < 0 {
+					return newError("argument 2 to `repeat` must not be negative, got %s",
+						args[1].Inspect())
+				}
+				if str == "" {
+					return &String{}
+				}
+				if !ok || count > maxStringSize/int64(len(str)) {
+					return newError("argument 2 to `repeat` is too large, got %s",
+						args[1].Inspect())
+				}
+				return &String{Value: strings.Repeat(str, int(count))}
+			},
+		},
+	},
+	{
+		"chars",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("chars", args, STRING_OBJ); err != nil {
+					return err
+				}
+				runes := []rune(args[0].(*String).Value)
+				chars := make([]string, len(runes))
+				for i, r := range runes {
+					chars[i] = string(r)
+				}
+				return stringArray(chars)
+			},
+		},
+	},
+	{
+		"map",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				if err := checkArgs("map", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+					return err
+				}
+				elements := args[0].(*Array).Elements
+				mapped := make([]Object, len(elements))
+				for i, el := range elements {
+					value := call(args[1], el)
+					if isError(value) {
+						return value
+					}
+					mapped[i] = value
+				}
+				return &Array{Elements: mapped}
+			},
+		},
+	},
+	{
+		"filter",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				if err := checkArgs("filter", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+					return err
+				}
+				filtered := []Object{}
+				for _, el := range args[0].(*Array).Elements {
+					keep := call(args[1], el)
+					if isError(keep) {
+						return keep
+					}
+					if isTruthy(keep) {
+						filtered = append(filtered, el)
+					}
+				}
+				return &Array{Elements: filtered}
+			},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				// reduce(arr, initial, fn(acc, x))
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3",
+						len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument 1 to `reduce` must be ARRAY, got %s",
+						args[0].Type())
+				}
+				if !isCallable(args[2]) {
+					return newError("argument 3 to `reduce` must be FUNCTION, got %s",
+						args[2].Type())
+				}
+
+				acc := args[1]
+				for _, el := range args[0].(*Array).Elements {
+					acc = call(args[2], acc, el)
+					if isError(acc) {
+						return acc
+					}
+				}
+				return acc
+			},
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				// sort(arr) sorts numbers or strings, sort(arr, less) sorts
+				// anything with a function telling if a comes before b
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2",
+						len(args))
+				}
+				types := []ObjectType{ARRAY_OBJ, FUNCTION_OBJ}
+				if err := checkArgs("sort", args, types[:len(args)]...); err != nil {
+					return err
+				}
+
+				sorted := make([]Object, len(args[0].(*Array).Elements))
+				copy(sorted, args[0].(*Array).Elements)
+
+				// the first error stops the comparisons, sort just finishes
+				// without them
+				var sortErr *Error
+				less := func(a, b Object) bool {
+					if sortErr != nil {
+						return false
+					}
+					if len(args) == 1 {
+						c, ok := Compare(a, b)
+						if !ok {
+							sortErr = newError("cannot compare %s and %s", a.Type(), b.Type())
+						}
+						return c < 0
+					}
+
+					result := call(args[1], a, b)
+					if isError(result) {
+						sortErr = result.(*Error)
+						return false
+					}
+					before, ok := result.(*Boolean)
+					if !ok {
+						sortErr = newError("sort function must return BOOLEAN, got %s",
+							result.Type())
+						return false
+					}
+					return before.Value
+				}
+				sort.SliceStable(sorted, func(i, j int) bool {
+					return less(sorted[i], sorted[j])
+				})
+
+				if sortErr != nil {
+					return sortErr
+				}
+				return &Array{Elements: sorted}
+			},
+		},
+	},
+	{
+		"any",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				if err := checkArgs("any", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+					return err
+				}
+				for _, el := range args[0].(*Array).Elements {
+					result := call(args[1], el)
+					if isError(result) {
+						return result
+					}
+					if isTruthy(result) {
+						return True
+					}
+				}
+				return False
+			},
+		},
+	},
+	{
+		"all",
+		&Builtin{
+			HigherOrder: func(call CallFunction, args ...Object) Object {
+				if err := checkArgs("all", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+					return err
+				}
+				for _, el := range args[0].(*Array).Elements {
+					result := call(args[1], el)
+					if isError(result) {
+						return result
+					}
+					if !isTruthy(result) {
+						return False
+					}
+				}
+				return True
+			},
+		},
+	},
+	{
+		"range",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// range(end), range(start, end) or range(start, end, step),
+				// end is excluded
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=1 to 3",
+						len(args))
+				}
+				types := []ObjectType{INTEGER_OBJ, INTEGER_OBJ, INTEGER_OBJ}
+				if err := checkArgs("range", args, types[:len(args)]...); err != nil {
+					return err
+				}
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					value, ok := smallInt(arg)
+					if !ok {
+						return newError("range too large: %s", arg.Inspect())
+					}
+					bounds[i] = value
+				}
+
+				start, end, step := int64(0), bounds[0], int64(1)
+				if len(bounds) > 1 {
+					start, end = bounds[0], bounds[1]
+				}
+				if len(bounds) > 2 {
+					step = bounds[2]
+				}
+				if step == 0 {
+					return newError("range step must not be 0")
+				}
+
+				// the differences are done in uint64 so they can't overflow
+				var count uint64
+				switch {
+				case step > 0 && end > start:
+					count = (uint64(end-start)-1)/uint64(step) + 1
+				case step < 0 && end < start:
+					count = (uint64(start-end)-1)/uint64(-step) + 1
+				}
+				if count > maxArraySize {
+					return newError("range too large: %d elements", count)
+				}
+
+				elements := make([]Object, count)
+				for i := range elements {
+					elements[i] = &Integer{Value: start + int64(i)*step}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"zip",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("zip", args, ARRAY_OBJ, ARRAY_OBJ); err != nil {
+					return err
+				}
+				// the pairs stop at the end of the shorter array
+				left, right := args[0].(*Array).Elements, args[1].(*Array).Elements
+				pairs := make([]Object, min(len(left), len(right)))
+				for i := range pairs {
+					pairs[i] = &Array{Elements: []Object{left[i], right[i]}}
+				}
+				return &Array{Elements: pairs}
+			},
+		},
+	},
+	{
+		"enumerate",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("enumerate", args, ARRAY_OBJ); err != nil {
+					return err
+				}
+				elements := args[0].(*Array).Elements
+				pairs := make([]Object, len(elements))
+				for i, el := range elements {
+					pairs[i] = &Array{Elements: []Object{&Integer{Value: int64(i)}, el}}
+				}
+				return &Array{Elements: pairs}
+			},
+		},
+	},
+	{
+		"reverse",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					reversed := make([]Object, len(arg.Elements))
+					for i, el := range arg.Elements {
+						reversed[len(reversed)-1-i] = el
+					}
+					return &Array{Elements: reversed}
+				case *String:
+					runes := []rune(arg.Value)
+					slices.Reverse(runes)
+					return &String{Value: string(runes)}
+				default:
+					return newError("argument to `reverse` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"keys",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("keys", args, HASH_OBJ); err != nil {
+					return err
+				}
+				pairs := args[0].(*Hash).Pairs()
+				keys := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					keys[i] = pair.Key
+				}
+				return &Array{Elements: keys}
+			},
+		},
+	},
+	{
+		"values",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("values", args, HASH_OBJ); err != nil {
+					return err
+				}
+				pairs := args[0].(*Hash).Pairs()
+				values := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					values[i] = pair.Value
+				}
+				return &Array{Elements: values}
+			},
+		},
+	},
+	{
+		"items",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("items", args, HASH_OBJ); err != nil {
+					return err
+				}
+				pairs := args[0].(*Hash).Pairs()
+				items := make([]Object, len(pairs))
+				for i, pair := range pairs {
+					items[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+				}
+				return &Array{Elements: items}
+			},
+		},
+	},
+	{
+		"has",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2",
+						len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("argument 1 to `has` must be HASH, got %s",
+						args[0].Type())
+				}
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				_, ok = hash.Get(key)
+				return NativeBool(ok)
+			},
+		},
+	},
+	{
+		"delete",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// like push, delete returns a new hash and leaves its argument alone
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2",
+						len(args))
+				}
+				hash, ok := args[0].(*Hash)
+				if !ok {
+					return newError("argument 1 to `delete` must be HASH, got %s",
+						args[0].Type())
+				}
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				deleted := hash.Copy()
+				deleted.Delete(key)
+				return deleted
+			},
+		},
+	},
+	{
+		"merge",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				// the pairs of the second hash win, new keys go to the end
+				if err := checkArgs("merge", args, HASH_OBJ, HASH_OBJ); err != nil {
+					return err
+				}
+				merged := args[0].(*Hash).Copy()
+				for _, pair := range args[1].(*Hash).Pairs() {
+					merged.Set(pair.Key.(Hashable), pair.Value)
+				}
+				return merged
+			},
+		},
+	},
+}
+
+// GetBuiltinByName returns the builtin with the given name or nil
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// maxStringSize limits the strings builtins like repeat make
+const maxStringSize = 1 << 30
+
+// maxArraySize limits the arrays builtins like range make
+const maxArraySize = 1 << 26
+
+// checkArgs checks the number and the types of the arguments of the builtin
+// name, so all builtins complain about bad arguments the same way.
+// FUNCTION accepts anything that can be called.
+func checkArgs(name string, args []Object, types ...ObjectType) *Error {
+	if len(args) != len(types) {
+		return newError("wrong number of arguments. got=%d, want=%d",
+			len(args), len(types))
+	}
+	for i, t := range types {
+		if args[i].Type() == t || t == FUNCTION_OBJ && isCallable(args[i]) {
+			continue
+		}
+		if len(types) == 1 {
+			return newError("argument to `%s` must be %s, got %s",
+				name, t, args[i].Type())
+		}
+		return newError("argument %d to `%s` must be %s, got %s",
+			i+1, name, t, args[i].Type())
+	}
+	return nil
+}
+
+// smallInt returns the value of an INTEGER, false for a big integer
+func smallInt(obj Object) (int64, bool) {
+	i, ok := obj.(*Integer)
+	if !ok {
+		return 0, false
+	}
+	return i.Value, true
+}
+
+func isCallable(obj Object) bool {
+	switch obj.Type() {
+	case FUNCTION_OBJ, CLOSURE_OBJ, BUILTIN_OBJ:
+		return true
+	}
+	return false
+}
+
+// isError is true for an error that wasn't caught, a caught error is
+// just a value
+func isError(obj Object) bool {
+	err, ok := obj.(*Error)
+	return ok && !err.Caught
+}
+
+// isTruthy is false for false and null only, like the condition of an if
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	}
+	return true
+}
+
+func stringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, v := range values {
+		elements[i] = &String{Value: v}
+	}
+	return &Array{Elements: elements}
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,99 @@
+package object
+
+import (
+	"cmp"
+	"strings"
+)
+
+// Equal is == for both backends. Numbers are equal by value, also an INTEGER
+// and a FLOAT, strings by content, arrays element by element and hashes when
+// they have the same keys with equal values, in any order. Booleans and null
+// are equal to themselves, functions and everything else only to the same
+// object.
+func Equal(a, b Object) bool {
+	return equal(a, b, map[[2]Object]bool{})
+}
+
+// seen holds the arrays and hashes being compared, an array that contains
+// itself would recurse forever otherwise. A pair that comes up again is
+// taken to be equal, if it isn't that shows somewhere else.
+func equal(a, b Object, seen map[[2]Object]bool) bool {
+	if c, ok := Compare(a, b); ok {
+		// NaN isn't equal to anything, not even itself
+		if x, ok := a.(*Float); ok && x.Value != x.Value {
+			return false
+		}
+		return c == 0
+	}
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if seen[[2]Object{a, b}] {
+			return true
+		}
+		seen[[2]Object{a, b}] = true
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		if seen[[2]Object{a, b}] {
+			return true
+		}
+		seen[[2]Object{a, b}] = true
+		for _, pair := range a.Pairs() {
+			value, ok := b.Get(pair.Key.(Hashable))
+			if !ok || !equal(pair.Value, value, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Compare orders numbers by value and strings by code point, it returns
+// -1, 0 or +1 like strings.Compare. False if a and b have no order.
+func Compare(a, b Object) (int, bool) {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return cmp.Compare(a.Value, b.Value), true
+		}
+	}
+	if a, ok := BigValue(a); ok {
+		if b, ok := BigValue(b); ok {
+			return a.Cmp(b), true
+		}
+	}
+	if a, ok := FloatValue(a); ok {
+		if b, ok := FloatValue(b); ok {
+			return cmp.Compare(a, b), true
+		}
+	}
+	if a, ok := a.(*String); ok {
+		if b, ok := b.(*String); ok {
+			// comparing UTF-8 bytewise is the same as comparing code points
+			return strings.Compare(a.Value, b.Value), true
+		}
+	}
+	return 0, false
+}
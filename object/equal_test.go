@@ -0,0 +1,94 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return h
+	}
+	str := func(s string) *String { return &String{Value: s} }
+	num := func(i int64) *Integer { return &Integer{Value: i} }
+	arr := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	nan := &Float{Value: math.NaN()}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{num(1), num(1), true},
+		{num(1), &Float{Value: 1}, true},
+		{&BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, true},
+		{nan, nan, false},
+		{str("a"), str("a"), true},
+		{str("a"), str("b"), false},
+		{str("1"), num(1), false},
+		{True, True, true},
+		{True, False, false},
+		{&Null{}, &Null{}, true},
+		{&Null{}, False, false},
+		{arr(num(1), str("a")), arr(num(1), str("a")), true},
+		{arr(num(1), arr(num(2))), arr(num(1), arr(num(2))), true},
+		{arr(num(1)), arr(num(1), num(2)), false},
+		{arr(num(1)), arr(num(2)), false},
+		{hash(str("a"), num(1), str("b"), num(2)), hash(str("b"), num(2), str("a"), num(1)), true},
+		{hash(str("a"), arr(num(1))), hash(str("a"), arr(num(1))), true},
+		{hash(str("a"), num(1)), hash(str("a"), num(2)), false},
+		{hash(str("a"), num(1)), hash(str("b"), num(1)), false},
+		{hash(), arr(), false},
+		{&Builtin{}, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] Equal(%s, %s) wrong. want=%t, got=%t",
+				i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestEqualCycle(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}, nil}}
+	a.Elements[1] = a
+	b := &Array{Elements: []Object{&Integer{Value: 1}, nil}}
+	b.Elements[1] = b
+
+	if !Equal(a, b) {
+		t.Errorf("arrays containing themselves aren't equal")
+	}
+	b.Elements[0] = &Integer{Value: 2}
+	if Equal(a, b) {
+		t.Errorf("different arrays containing themselves are equal")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Object
+		expected int
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1},
+		{&Float{Value: 2.5}, &Integer{Value: 2}, 1},
+		{&String{Value: "abc"}, &String{Value: "abd"}, -1},
+		{&String{Value: "b"}, &String{Value: "ä"}, -1},
+		{&String{Value: ""}, &String{Value: ""}, 0},
+	}
+
+	for i, tt := range tests {
+		got, ok := Compare(tt.a, tt.b)
+		if !ok || got != tt.expected {
+			t.Errorf("tests[%d] wrong. want=%d, got=%d (%t)", i, tt.expected, got, ok)
+		}
+	}
+
+	if _, ok := Compare(&String{Value: "a"}, &Integer{Value: 1}); ok {
+		t.Errorf("a string and an integer have an order")
+	}
+}
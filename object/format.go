@@ -0,0 +1,85 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatString is the implementation of the format builtin. It knows the
+// verbs %d, %f, %s and %v with the flags - and 0, a width and a precision
+// like in Go, e.g. %-8s or %6.2f. %s and %v print any value like puts does.
+// The errors count the arguments like the builtin does, format is the first.
+func formatString(format string, args []Object) (string, error) {
+	var out strings.Builder
+	next := 0 // index of the next argument
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		// the spec is everything from the % up to the verb
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("-0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && isDigit(format[i]) {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && isDigit(format[i]) {
+				i++
+			}
+		}
+		if i >= len(format) {
+			return "", fmt.Errorf("argument 1 to `format` is missing a verb at the end")
+		}
+		verb := format[i]
+		spec := format[start:i]
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if strings.IndexByte("dfsv", verb) < 0 {
+			return "", fmt.Errorf("argument 1 to `format` has an unknown verb %%%c", verb)
+		}
+		if next >= len(args) {
+			return "", fmt.Errorf("wrong number of arguments. got=%d, want at least %d",
+				len(args)+1, next+2)
+		}
+		arg := args[next]
+		next++
+
+		switch verb {
+		case 'd':
+			value, ok := BigValue(arg)
+			if !ok {
+				return "", fmt.Errorf("argument %d to `format` must be INTEGER, got %s",
+					next+1, arg.Type())
+			}
+			fmt.Fprintf(&out, spec+"d", value)
+		case 'f':
+			value, ok := FloatValue(arg)
+			if !ok {
+				return "", fmt.Errorf("argument %d to `format` must be FLOAT or INTEGER, got %s",
+					next+1, arg.Type())
+			}
+			fmt.Fprintf(&out, spec+"f", value)
+		case 's', 'v':
+			fmt.Fprintf(&out, spec+"s", arg.Inspect())
+		}
+	}
+
+	if next < len(args) {
+		return "", fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args)+1, next+1)
+	}
+	return out.String(), nil
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,64 @@
+package object
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatString(t *testing.T) {
+	bigValue, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	tests := []struct {
+		format   string
+		args     []Object
+		expected string
+	}{
+		{"plain", nil, "plain"},
+		{"%d%%", []Object{&Integer{Value: 50}}, "50%"},
+		{"[%5d|%-5d|%05d]", []Object{&Integer{Value: 42}, &Integer{Value: 42}, &Integer{Value: -42}}, "[   42|42   |-0042]"},
+		{"%d", []Object{&BigInt{Value: bigValue}}, "123456789012345678901234567890"},
+		{"%.2f %f", []Object{&Float{Value: 3.14159}, &Integer{Value: 2}}, "3.14 2.000000"},
+		{"%8.3f|", []Object{&Float{Value: -1.5}}, "  -1.500|"},
+		{"%s and %v", []Object{&String{Value: "text"}, &Array{Elements: []Object{&Integer{Value: 1}}}}, "text and [1]"},
+		{"%-6s|%6s|", []Object{&String{Value: "äb"}, &Boolean{Value: true}}, "äb    |  true|"},
+		{"%.3s", []Object{&String{Value: "monkey"}}, "mon"},
+		{"%v", []Object{&Float{Value: 2}}, "2.0"},
+	}
+
+	for _, tt := range tests {
+		result, err := formatString(tt.format, tt.args)
+		if err != nil {
+			t.Errorf("formatString(%q) returned an error: %s", tt.format, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("formatString(%q) wrong. want=%q, got=%q", tt.format, tt.expected, result)
+		}
+	}
+}
+
+func TestFormatStringErrors(t *testing.T) {
+	tests := []struct {
+		format   string
+		args     []Object
+		expected string
+	}{
+		{"%d", nil, "wrong number of arguments. got=1, want at least 2"},
+		{"%d", []Object{&String{Value: "1"}}, "argument 2 to `format` must be INTEGER, got STRING"},
+		{"%s %f", []Object{&String{Value: "a"}, &Boolean{Value: true}}, "argument 3 to `format` must be FLOAT or INTEGER, got BOOLEAN"},
+		{"%x", []Object{&Integer{Value: 1}}, "argument 1 to `format` has an unknown verb %x"},
+		{"50%", nil, "argument 1 to `format` is missing a verb at the end"},
+		{"%d", []Object{&Integer{Value: 1}, &Integer{Value: 2}}, "wrong number of arguments. got=3, want=2"},
+	}
+
+	for _, tt := range tests {
+		_, err := formatString(tt.format, tt.args)
+		if err == nil {
+			t.Errorf("formatString(%q) returned no error", tt.format)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("formatString(%q) wrong error. want=%q, got=%q", tt.format, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package object
+
+import "math"
+
+// Hash keeps its pairs in insertion order, so printing and iterating a hash
+// gives the same order every time and in both backends. Setting a key that's
+// already there keeps its position.
+//
+// Keys whose hash keys collide share a bucket and are told apart by
+// comparing the keys themselves.
+type Hash struct {
+	pairs   []HashPair        // a deleted pair has a nil Key until the next compaction
+	index   map[HashKey][]int // positions in pairs of the keys with that hash key
+	hasher  Hasher
+	deleted int
+}
+
+// Hasher computes the hash keys of a Hash, Hashable.HashKey unless a test
+// wants keys that collide on purpose
+type Hasher func(key Hashable) HashKey
+
+// NewHash returns an empty hash with room for size pairs
+func NewHash(size int) *Hash {
+	return NewHashWith(size, Hashable.HashKey)
+}
+
+// NewHashWith returns an empty hash that uses hasher for its keys
+func NewHashWith(size int, hasher Hasher) *Hash {
+	return &Hash{
+		pairs:  make([]HashPair, 0, size),
+		index:  make(map[HashKey][]int, size),
+		hasher: hasher,
+	}
+}
+
+// lookup returns the hash key of key and the position of its pair,
+// -1 if the hash doesn't have it
+func (h *Hash) lookup(key Hashable) (HashKey, int) {
+	hashKey := h.hasher(key)
+	for _, i := range h.index[hashKey] {
+		if sameKey(h.pairs[i].Key, key) {
+			return hashKey, i
+		}
+	}
+	return hashKey, -1
+}
+
+// sameKey is == for keys, except that NaN is the same key as NaN so it
+// can be found again
+func sameKey(a, b Object) bool {
+	if x, ok := a.(*Float); ok && math.IsNaN(x.Value) {
+		y, ok := b.(*Float)
+		return ok && math.IsNaN(y.Value)
+	}
+	return Equal(a, b)
+}
+
+// Get returns the value of key, false if the hash doesn't have it
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	_, i := h.lookup(key)
+	if i < 0 {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set adds key with value at the end, or replaces the value if key is there
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey, i := h.lookup(key)
+	if i >= 0 {
+		h.pairs[i].Value = value
+		return
+	}
+	h.index[hashKey] = append(h.index[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Delete removes key, false if the hash didn't have it
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey, i := h.lookup(key)
+	if i < 0 {
+		return false
+	}
+
+	bucket := h.index[hashKey]
+	for j, pos := range bucket {
+		if pos == i {
+			bucket = append(bucket[:j], bucket[j+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(h.index, hashKey)
+	} else {
+		h.index[hashKey] = bucket
+	}
+	h.pairs[i] = HashPair{}
+	h.deleted++
+
+	// the holes are dropped once they are half of the pairs, so deleting
+	// stays cheap and the pairs don't grow forever
+	if h.deleted > len(h.pairs)/2 {
+		h.compact()
+	}
+	return true
+}
+
+func (h *Hash) compact() {
+	pairs := make([]HashPair, 0, h.Len())
+	index := make(map[HashKey][]int, h.Len())
+	for _, pair := range h.pairs {
+		if pair.Key == nil {
+			continue
+		}
+		hashKey := h.hasher(pair.Key.(Hashable))
+		index[hashKey] = append(index[hashKey], len(pairs))
+		pairs = append(pairs, pair)
+	}
+	h.pairs = pairs
+	h.index = index
+	h.deleted = 0
+}
+
+// Copy returns a new hash with the same pairs in the same order
+func (h *Hash) Copy() *Hash {
+	c := NewHashWith(h.Len(), h.hasher)
+	for _, pair := range h.Pairs() {
+		c.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return c
+}
+
+// Len returns the number of pairs
+func (h *Hash) Len() int {
+	return len(h.pairs) - h.deleted
+}
+
+// Pairs returns the pairs in insertion order, the slice is a copy
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
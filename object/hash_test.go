@@ -0,0 +1,151 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestHashOrder(t *testing.T) {
+	h := NewHash(0)
+	for _, k := range []string{"c", "a", "b"} {
+		h.Set(&String{Value: k}, &Integer{Value: 1})
+	}
+	h.Set(&String{Value: "a"}, &Integer{Value: 2}) // keeps its place
+	h.Delete(&String{Value: "c"})
+	h.Set(&String{Value: "c"}, &Integer{Value: 3}) // goes to the end
+
+	if got := h.Inspect(); got != `{a: 2, b: 1, c: 3}` {
+		t.Errorf("wrong order. got=%s", got)
+	}
+	if h.Len() != 3 {
+		t.Errorf("wrong length. got=%d", h.Len())
+	}
+}
+
+func TestHashDelete(t *testing.T) {
+	h := NewHash(0)
+	for i := 0; i < 100; i++ {
+		h.Set(&Integer{Value: int64(i)}, &Integer{Value: int64(i * 10)})
+	}
+	// deletes enough to compact a few times on the way
+	for i := 0; i < 100; i += 3 {
+		if !h.Delete(&Integer{Value: int64(i)}) {
+			t.Fatalf("key %d not deleted", i)
+		}
+	}
+	if h.Delete(&Integer{Value: 0}) {
+		t.Errorf("deleted key 0 twice")
+	}
+
+	want := []int64{}
+	for i := int64(0); i < 100; i++ {
+		if i%3 != 0 {
+			want = append(want, i)
+		}
+	}
+	pairs := h.Pairs()
+	if len(pairs) != len(want) || h.Len() != len(want) {
+		t.Fatalf("wrong number of pairs. want=%d, got=%d (len %d)", len(want), len(pairs), h.Len())
+	}
+	for i, pair := range pairs {
+		if key := pair.Key.(*Integer).Value; key != want[i] {
+			t.Fatalf("pair %d has wrong key. want=%d, got=%d", i, want[i], key)
+		}
+		value, ok := h.Get(pair.Key.(Hashable))
+		if !ok || value.(*Integer).Value != want[i]*10 {
+			t.Errorf("wrong value for key %d. got=%v", want[i], value)
+		}
+	}
+}
+
+func TestHashCopy(t *testing.T) {
+	h := NewHash(0)
+	h.Set(&String{Value: "a"}, &Integer{Value: 1})
+
+	c := h.Copy()
+	c.Set(&String{Value: "b"}, &Integer{Value: 2})
+	c.Delete(&String{Value: "a"})
+
+	if got := fmt.Sprint(h.Inspect(), " ", c.Inspect()); got != `{a: 1} {b: 2}` {
+		t.Errorf("copy isn't independent. got=%s", got)
+	}
+}
+
+// TestHashCollisions runs random sets and deletes on hashes whose hash keys
+// collide on purpose and checks them against a model keyed by the real hash
+// keys, which don't collide for these keys
+func TestHashCollisions(t *testing.T) {
+	keys := []Hashable{
+		&String{Value: "a"}, &String{Value: "b"}, &String{Value: "c"}, &String{Value: "1"},
+		&Integer{Value: 0}, &Integer{Value: 1}, &Integer{Value: -1}, &Integer{Value: 2},
+		&Float{Value: 1}, &Float{Value: 2.5}, &Float{Value: math.NaN()},
+		True, False,
+		&BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)},
+	}
+
+	hashers := map[string]Hasher{
+		"default":  Hashable.HashKey,
+		"constant": func(Hashable) HashKey { return HashKey{} },
+		"mod3": func(key Hashable) HashKey {
+			return HashKey{Value: key.HashKey().Value % 3}
+		},
+	}
+
+	for name, hasher := range hashers {
+		rnd := rand.New(rand.NewSource(1))
+		h := NewHashWith(0, hasher)
+
+		var order []HashKey // the model
+		values := map[HashKey]int64{}
+
+		for step := 0; step < 2000; step++ {
+			key := keys[rnd.Intn(len(keys))]
+			hashKey := key.HashKey()
+
+			if rnd.Intn(3) == 0 {
+				_, had := values[hashKey]
+				if h.Delete(key) != had {
+					t.Fatalf("%s: step %d: Delete(%s) wrong, want=%t", name, step, key.Inspect(), had)
+				}
+				if had {
+					delete(values, hashKey)
+					for i, k := range order {
+						if k == hashKey {
+							order = append(order[:i], order[i+1:]...)
+							break
+						}
+					}
+				}
+			} else {
+				value := int64(step)
+				h.Set(key, &Integer{Value: value})
+				if _, ok := values[hashKey]; !ok {
+					order = append(order, hashKey)
+				}
+				values[hashKey] = value
+			}
+
+			if h.Len() != len(order) {
+				t.Fatalf("%s: step %d: wrong length. want=%d, got=%d", name, step, len(order), h.Len())
+			}
+			for i, pair := range h.Pairs() {
+				k := pair.Key.(Hashable).HashKey()
+				if k != order[i] || pair.Value.(*Integer).Value != values[k] {
+					t.Fatalf("%s: step %d: wrong pair %d: %s: %s", name, step, i,
+						pair.Key.Inspect(), pair.Value.Inspect())
+				}
+			}
+			for _, key := range keys {
+				want, ok := values[key.HashKey()]
+				got, found := h.Get(key)
+				if found != ok || found && got.(*Integer).Value != want {
+					t.Fatalf("%s: step %d: Get(%s) wrong. want=%d (%t), got=%v (%t)",
+						name, step, key.Inspect(), want, ok, got, found)
+				}
+			}
+		}
+	}
+}
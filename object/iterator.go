@@ -0,0 +1,43 @@
+package object
+
+// Iterator steps through the elements of an array, the characters of a
+// string or the keys of a hash, for loops use it in both backends
+type Iterator struct {
+	elements []Object
+	next     int
+}
+
+// NewIterator returns an iterator over obj, false if obj can't be iterated
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return &Iterator{elements: obj.Elements}, true
+
+	case *String:
+		elements := []Object{}
+		for _, ch := range obj.Value {
+			elements = append(elements, &String{Value: string(ch)})
+		}
+		return &Iterator{elements: elements}, true
+
+	case *Hash:
+		elements := make([]Object, 0, obj.Len())
+		for _, pair := range obj.Pairs() {
+			elements = append(elements, pair.Key)
+		}
+		return &Iterator{elements: elements}, true
+	}
+	return nil, false
+}
+
+// Next returns the next element, false once all elements were returned
+func (it *Iterator) Next() (Object, bool) {
+	if it.next >= len(it.elements) {
+		return nil, false
+	}
+	it.next++
+	return it.elements[it.next-1], true
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
@@ -0,0 +1,74 @@
+package object
+
+import (
+	"fmt"
+	"monkey/module"
+)
+
+// Module is the namespace an import binds, it holds the bindings the
+// module exported when it finished running
+type Module struct {
+	Name    string
+	Exports *Hash
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("<module %s>", m.Name) }
+
+// Export returns the exported binding name
+func (m *Module) Export(name string) (Object, bool) {
+	return m.Exports.Get(&String{Value: name})
+}
+
+// Imports are the modules a program imported in the evaluator. The program
+// and its modules share them, so every module runs once.
+type Imports struct {
+	Loader  *module.Loader
+	modules map[string]*Module // by file
+	loadErr *Error             // the error of a module that couldn't be loaded
+}
+
+func NewImports(loader *module.Loader) *Imports {
+	return &Imports{Loader: loader, modules: map[string]*Module{}}
+}
+
+// Get returns the module loaded from file, false if it wasn't imported yet
+func (i *Imports) Get(file string) (*Module, bool) {
+	m, ok := i.modules[file]
+	return m, ok
+}
+
+func (i *Imports) Add(file string, m *Module) {
+	i.modules[file] = m
+}
+
+// LoadFailed records err as the error of a module that couldn't be found or
+// loaded and returns it
+func (i *Imports) LoadFailed(err *Error) *Error {
+	i.loadErr = err
+	return err
+}
+
+// IsLoadError reports whether err is the error recorded by LoadFailed, the
+// vm reports such errors when compiling
+func (i *Imports) IsLoadError(err *Error) bool {
+	return err != nil && err == i.loadErr
+}
+
+// Imports returns the imports of the program env belongs to, a program
+// that didn't set any gets imports without a search path
+func (e *Environment) Imports() *Imports {
+	for e.outer != nil {
+		e = e.outer
+	}
+	if e.imports == nil {
+		e.imports = NewImports(module.NewLoader(nil))
+	}
+	return e.imports
+}
+
+// SetImports sets the imports of the program env is the outermost
+// environment of
+func (e *Environment) SetImports(imports *Imports) {
+	e.imports = imports
+}
@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/token"
+	"os"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +19,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -23,6 +30,12 @@ const (
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
+	ITERATOR_OBJ          = "ITERATOR"
+	MODULE_OBJ            = "MODULE"
 )
 
 type Object interface {
@@ -30,7 +43,9 @@ type Object interface {
 	Inspect() string
 }
 
+// Hashable objects can be hash keys
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -38,18 +53,46 @@ type Integer struct {
 	Value int64
 }
 
+type Float struct {
+	Value float64
+}
+
 type Boolean struct {
 	Value bool
 }
 
+// True and False are the only booleans, the backends compare them by identity
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
+// NativeBool returns True or False
+func NativeBool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
 type Null struct{}
 
 type ReturnValue struct {
 	Value Object
 }
 
+// Break and Continue bubble up the blocks of a loop body in the evaluator
+// like ReturnValue does for function bodies
+type Break struct{}
+type Continue struct{}
+
 type Error struct {
 	Message string
+	Pos     token.Position // where the error happened, if known
+
+	// Caught marks an error that was caught by try/catch and is an ordinary
+	// value from then on, only errors that aren't caught abort the program
+	Caught bool
 }
 
 type String struct {
@@ -58,8 +101,35 @@ type String struct {
 
 type BuiltinFunction func(args ...Object) Object
 
+// CallFunction calls a Monkey function with args. Builtins that take
+// functions, like map, get one from the backend that runs them. An error
+// the function doesn't catch comes back as an *Error.
+type CallFunction func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is a builtin that calls functions it's given
+type HigherOrderFunction func(call CallFunction, args ...Object) Object
+
+// OutputFunction is a builtin that prints, like puts. It writes to the
+// output of the backend that runs it.
+type OutputFunction func(out io.Writer, args ...Object) Object
+
+// Builtin has either Fn, HigherOrder or Output
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn          BuiltinFunction
+	HigherOrder HigherOrderFunction
+	Output      OutputFunction
+}
+
+// Call runs the builtin, call is only used by higher order builtins and out
+// by the ones that print
+func (b *Builtin) Call(call CallFunction, out io.Writer, args ...Object) Object {
+	switch {
+	case b.HigherOrder != nil:
+		return b.HigherOrder(call, args...)
+	case b.Output != nil:
+		return b.Output(out, args...)
+	}
+	return b.Fn(args...)
 }
 
 type Array struct {
@@ -67,7 +137,7 @@ type Array struct {
 }
 
 type HashKey struct {
-	Type  ObjectType // bool, int or string
+	Type  ObjectType // bool, int, float or string
 	Value uint64
 }
 
@@ -76,19 +146,43 @@ type HashPair struct {
 	Value Object
 }
 
-type Hash struct {
-	Pairs map[HashKey]HashPair
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // number of local bindings, reserved on the stack when the function is called
+	NumParameters int // number of parameters the function expects
+
+	Name     string         // name of the let binding, empty for anonymous functions
+	Lines    code.LineTable // source positions of the instructions
+	Handlers code.HandlerTable
+
+	LocalNames []string // names of the local slots by index, for error messages
+	FreeNames  []string // names of the free variables by index, for error messages
 }
 
-type CompiledFunction struct {
-	Instructions code.Instructions
+// Closure is a CompiledFunction together with the free variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
 }
 
+// Cell holds a local variable of the vm that a closure captured. The
+// function that defines the variable and its closures share the cell, so
+// an assignment is seen by all of them. Cells never reach Monkey code.
+type Cell struct {
+	Value Object // nil until the let statement of the variable ran
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return fmt.Sprintf("Cell[%p]", c) }
+
 // Type functions
 func (i *Integer) Type() ObjectType      { return INTEGER_OBJ }
+func (f *Float) Type() ObjectType        { return FLOAT_OBJ }
 func (b *Boolean) Type() ObjectType      { return BOOLEAN_OBJ }
 func (n *Null) Type() ObjectType         { return NULL_OBJ }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (b *Break) Type() ObjectType        { return BREAK_OBJ }
+func (c *Continue) Type() ObjectType     { return CONTINUE_OBJ }
 func (e *Error) Type() ObjectType        { return ERROR_OBJ }
 func (s *String) Type() ObjectType       { return STRING_OBJ }
 func (b *Builtin) Type() ObjectType      { return BUILTIN_OBJ }
@@ -96,6 +190,7 @@ func (ao *Array) Type() ObjectType       { return ARRAY_OBJ }
 func (h *Hash) Type() ObjectType         { return HASH_OBJ }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (c *Closure) Type() ObjectType           { return CLOSURE_OBJ }
 
 // env
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -105,7 +200,53 @@ func (i *Integer) Inspect() string      { return fmt.Sprintf("%d", i.Value) }
 func (b *Boolean) Inspect() string      { return fmt.Sprintf("%t", b.Value) }
 func (n *Null) Inspect() string         { return "null" }
 func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
-func (e *Error) Inspect() string        { return "ERROR: " + e.Message }
+func (b *Break) Inspect() string        { return "break" }
+func (c *Continue) Inspect() string     { return "continue" }
+
+// Inspect keeps a ".0" on whole floats so 2.0 doesn't print like the integer 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
+
+// Field returns the parts of an error Monkey code can index:
+// "message", "file", "line" and "column"
+func (e *Error) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}, true
+	case "file":
+		return &String{Value: e.Pos.File}, true
+	case "line":
+		return &Integer{Value: int64(e.Pos.Line)}, true
+	case "column":
+		return &Integer{Value: int64(e.Pos.Column)}, true
+	}
+	return nil, false
+}
+
+// NewThrownError turns the value of a throw statement into the error that
+// is raised, a caught error is thrown again with its original position
+func NewThrownError(val Object) *Error {
+	switch val := val.(type) {
+	case *Error:
+		return &Error{Message: val.Message, Pos: val.Pos}
+	case *String:
+		return &Error{Message: val.Value}
+	default:
+		return &Error{Message: val.Inspect()}
+	}
+}
+
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("ERROR: %s: %s", e.Pos, e.Message)
+	}
+	return "ERROR: " + e.Message
+}
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
@@ -145,7 +286,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -161,6 +302,10 @@ func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
 
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
 // Environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
@@ -170,6 +315,11 @@ func NewEnvironment() *Environment {
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// imports and out are set in the outermost environment, see Imports
+	// and Output
+	imports *Imports
+	out     io.Writer
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -186,6 +336,36 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Assign updates name in the environment that defined it,
+// false if name isn't defined
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+// Output returns where the program env belongs to prints, os.Stdout unless
+// SetOutput changed it
+func (e *Environment) Output() io.Writer {
+	for e.outer != nil {
+		e = e.outer
+	}
+	if e.out == nil {
+		return os.Stdout
+	}
+	return e.out
+}
+
+// SetOutput sets where the program env is the outermost environment of prints
+func (e *Environment) SetOutput(out io.Writer) {
+	e.out = out
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
@@ -202,7 +382,7 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 //
 // Hashs
 
-// HashKey methods for boolean, integer and string
+// HashKey methods for boolean, integer, float and string
 // return a hash for the hashmap keys
 
 func (b *Boolean) HashKey() HashKey {
@@ -221,9 +401,65 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// a whole float hashes like the integer with the same value, so 1 and 1.0
+// are the same hash key
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) {
+		if i, ok := IntegerFromFloat(f.Value); ok {
+			return i.(Hashable).HashKey()
+		}
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
 
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+
+// FloatValue returns the value of an integer or a float as a float64,
+// false for anything that isn't a number
+func FloatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+// IsNumber reports whether obj is an integer or a float
+func IsNumber(obj Object) bool {
+	_, ok := FloatValue(obj)
+	return ok
+}
+
+// FloatOperation applies the arithmetic operator to two numbers as floats.
+// It follows IEEE 754 like Go does, dividing by zero gives an infinity and
+// not an error. The bitwise operators only work on integers.
+func FloatOperation(operator string, left, right Object) (Object, error) {
+	leftValue, _ := FloatValue(left)
+	rightValue, _ := FloatValue(right)
+
+	switch operator {
+	case "+":
+		return &Float{Value: leftValue + rightValue}, nil
+	case "-":
+		return &Float{Value: leftValue - rightValue}, nil
+	case "*":
+		return &Float{Value: leftValue * rightValue}, nil
+	case "/":
+		return &Float{Value: leftValue / rightValue}, nil
+	case "%":
+		return &Float{Value: math.Mod(leftValue, rightValue)}, nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +22,164 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	whole := &Float{Value: 2.0}
+	one := &Integer{Value: 2}
+	half1 := &Float{Value: 2.5}
+	half2 := &Float{Value: 2.5}
+
+	if whole.HashKey() != one.HashKey() {
+		t.Errorf("whole float and integer with same value have different hash keys")
+	}
+	if half1.HashKey() != half2.HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if half1.HashKey() == whole.HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2, "2.0"},
+		{2.5, "2.5"},
+		{-0.25, "-0.25"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g. want=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestFloatOperation(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right Object
+		expected    float64
+	}{
+		{"+", &Float{Value: 0.25}, &Integer{Value: 1}, 1.25},
+		{"-", &Integer{Value: 1}, &Float{Value: 0.5}, 0.5},
+		{"*", &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}, &Float{Value: 0.5}, 9223372036854775808.0},
+		{"/", &Float{Value: 1}, &Integer{Value: 0}, math.Inf(1)},
+		{"%", &Float{Value: 7.5}, &Integer{Value: 2}, 1.5},
+	}
+
+	for i, tt := range tests {
+		result, err := FloatOperation(tt.operator, tt.left, tt.right)
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %s", i, err)
+		}
+		f, ok := result.(*Float)
+		if !ok || f.Value != tt.expected {
+			t.Errorf("tests[%d] - wrong result. want=%g, got=%s", i, tt.expected, result.Inspect())
+		}
+	}
+
+	_, err := FloatOperation("&", &Float{Value: 0.5}, &Integer{Value: 1})
+	if err == nil || err.Error() != "unknown operator: FLOAT & INTEGER" {
+		t.Errorf("wrong error for a bitwise operator. got=%v", err)
+	}
+}
+
+func TestBigIntHashKey(t *testing.T) {
+	big1 := NewInteger(new(big.Int).Lsh(big.NewInt(1), 64)).(Hashable)
+	big2 := NewInteger(new(big.Int).Lsh(big.NewInt(1), 64)).(Hashable)
+	diff := NewInteger(new(big.Int).Lsh(big.NewInt(-1), 64)).(Hashable)
+	float := &Float{Value: 1 << 64}
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.HashKey() == diff.HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+	if big1.HashKey() != float.HashKey() {
+		t.Errorf("whole float and big integer with same value have different hash keys")
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	if _, ok := NewInteger(big.NewInt(math.MaxInt64)).(*Integer); !ok {
+		t.Errorf("NewInteger didn't return an Integer for a value that fits into int64")
+	}
+	tooBig := new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1))
+	if _, ok := NewInteger(tooBig).(*BigInt); !ok {
+		t.Errorf("NewInteger didn't return a BigInt for a value that doesn't fit into int64")
+	}
+}
+
+func TestInt64Overflow(t *testing.T) {
+	tests := []struct {
+		op       func(a, b int64) (int64, bool)
+		a, b     int64
+		expected bool
+	}{
+		{AddInt64, math.MaxInt64, 1, false},
+		{AddInt64, math.MaxInt64, -1, true},
+		{AddInt64, math.MinInt64, -1, false},
+		{SubInt64, math.MinInt64, 1, false},
+		{SubInt64, 0, math.MinInt64, false},
+		{SubInt64, -1, math.MinInt64, true},
+		{MulInt64, math.MinInt64, -1, false},
+		{MulInt64, -1, math.MinInt64, false},
+		{MulInt64, 1 << 32, 1 << 31, false},
+		{MulInt64, 1 << 31, 1 << 31, true},
+		{MulInt64, 0, math.MinInt64, true},
+	}
+
+	for i, tt := range tests {
+		if _, ok := tt.op(tt.a, tt.b); ok != tt.expected {
+			t.Errorf("tests[%d] - wrong overflow check for %d and %d. want ok=%t, got=%t",
+				i, tt.a, tt.b, tt.expected, ok)
+		}
+	}
+}
+
+func TestIntegerOperation(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right Object
+		expected    string
+	}{
+		{"+", &Integer{Value: math.MaxInt64}, &Integer{Value: 1}, "9223372036854775808"},
+		{"/", &Integer{Value: math.MinInt64}, &Integer{Value: -1}, "9223372036854775808"},
+		{"<<", &Integer{Value: 1}, &Integer{Value: 64}, "18446744073709551616"},
+		{"-", &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}, &Integer{Value: 1 << 62}, "13835058055282163712"},
+		{"%", &Integer{Value: 7}, &Integer{Value: -2}, "1"},
+	}
+
+	for i, tt := range tests {
+		result, err := IntegerOperation(tt.operator, tt.left, tt.right)
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %s", i, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("tests[%d] - wrong result. want=%s, got=%s", i, tt.expected, result.Inspect())
+		}
+	}
+
+	// results that fit into an int64 are Integers again
+	large := &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	result, _ := IntegerOperation("/", large, large)
+	if integer, ok := result.(*Integer); !ok || integer.Value != 1 {
+		t.Errorf("wrong result for a small big.Int result. got=%T %s", result, result.Inspect())
+	}
+
+	if _, err := IntegerOperation("/", &Integer{Value: 1}, &Integer{Value: 0}); err == nil ||
+		err.Error() != "division by zero" {
+		t.Errorf("wrong error for a division by zero. got=%v", err)
+	}
+	if neg := NegateInteger(&Integer{Value: math.MinInt64}); neg.Inspect() != "9223372036854775808" {
+		t.Errorf("wrong negation of math.MinInt64. got=%s", neg.Inspect())
+	}
+}
@@ -0,0 +1,93 @@
+package object
+
+import "fmt"
+
+// Arrays and strings are sequences, strings count code points.
+// Both backends index and slice them with these functions so they agree on
+// negative indices and on what happens out of range.
+
+// SequenceIndex returns the position of index in a sequence of the given
+// length, negative indices count from the end: -1 is the last element.
+// False when the index is out of range.
+func SequenceIndex(index Object, length int) (int, bool) {
+	i, ok := index.(*Integer) // a big integer is always out of range
+	if !ok {
+		return 0, false
+	}
+	pos := i.Value
+	if pos < 0 {
+		pos += int64(length)
+	}
+	if pos < 0 || pos >= int64(length) {
+		return 0, false
+	}
+	return int(pos), true
+}
+
+// Slice returns left[start:end] for an array or a string. A NULL bound was
+// left out. The bounds may be negative like indices and are clamped to the
+// sequence, so a slice is never out of range, it's empty at worst.
+func Slice(left, start, end Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		from, to, err := sliceBounds(start, end, len(left.Elements))
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &Array{Elements: elements}, nil
+	case *String:
+		runes := []rune(left.Value)
+		from, to, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: string(runes[from:to])}, nil
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
+func sliceBounds(start, end Object, length int) (int, int, error) {
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		to = from
+	}
+	return from, to, nil
+}
+
+func sliceBound(bound Object, missing, length int) (int, error) {
+	if bound.Type() == NULL_OBJ {
+		return missing, nil
+	}
+	value, ok := BigValue(bound)
+	if !ok {
+		return 0, fmt.Errorf("slice index must be INTEGER, got %s", bound.Type())
+	}
+	if !value.IsInt64() {
+		if value.Sign() < 0 {
+			return 0, nil
+		}
+		return length, nil
+	}
+
+	pos := value.Int64()
+	if pos < 0 {
+		pos += int64(length)
+	}
+	switch {
+	case pos < 0:
+		return 0, nil
+	case pos > int64(length):
+		return length, nil
+	}
+	return int(pos), nil
+}
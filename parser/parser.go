@@ -1,17 +1,24 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // the precedence order of operations
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	LESSGREATER
 	SUM
@@ -21,17 +28,32 @@ const (
 	INDEX
 )
 
+// the bitwise operators bind like in Go, so a & 1 == 0 is (a & 1) == 0
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:       ASSIGN,
+	token.PLUS_ASSIGN:  ASSIGN,
+	token.MINUS_ASSIGN: ASSIGN,
+	token.OR:           LOGICAL_OR,
+	token.AND:          LOGICAL_AND,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.LT_EQ:        LESSGREATER,
+	token.GT_EQ:        LESSGREATER,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.BIT_OR:       SUM,
+	token.BIT_XOR:      SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.PERCENT:      PRODUCT,
+	token.BIT_AND:      PRODUCT,
+	token.SHIFT_LEFT:   PRODUCT,
+	token.SHIFT_RIGHT:  PRODUCT,
+	token.LPAREN:       CALL,
+	token.LBRACKET:     INDEX,
+	token.DOT:          INDEX,
 }
 
 type (
@@ -50,6 +72,14 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// number of loops around the current statement in the current function,
+	// break and continue are only allowed inside a loop
+	loopDepth int
+
+	// number of blocks around the current statement, import and export are
+	// only allowed outside of all blocks
+	blockDepth int
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -66,14 +96,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
@@ -87,8 +121,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	return p
 }
@@ -158,7 +206,8 @@ func (p *Parser) Errors() []string {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	msg := fmt.Sprintf("%s: expected next token to be %s, got %s instead",
+		p.peekToken.Pos,
 		t,
 		p.peekToken.Type)
 	p.errors = append(p.errors, msg) // adding errors to parser
@@ -166,7 +215,7 @@ func (p *Parser) peekError(t token.TokenType) {
 
 // noPrefixParseFnError
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
+	msg := fmt.Sprintf("%s: no prefix parse function for %s found", p.curToken.Pos, t)
 	p.errors = append(p.errors, msg)
 }
 
@@ -180,6 +229,18 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		stmt := p.parseExpressionStatement()
 		// if next token is a semicolon, consume it
@@ -209,6 +270,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// let the function know its own name, so it can refer to itself
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	// if the next token is a semicolon, consume it.
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -222,6 +288,72 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parseImportStatement parses import "<path>" and import "<path>" as <name>
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	p.checkTopLevel()
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+
+	// as is only a keyword here, it can still name variables
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	} else {
+		name := strings.TrimSuffix(filepath.Base(stmt.Path), filepath.Ext(stmt.Path))
+		if !isIdentifier(name) {
+			msg := fmt.Sprintf("%s: can't name the module %q after its file, use import %q as <name>",
+				stmt.Token.Pos, stmt.Path, stmt.Path)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		nameTok := token.Token{Type: token.IDENT, Literal: name, Pos: stmt.Token.Pos}
+		stmt.Name = &ast.Identifier{Token: nameTok, Value: name}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// isIdentifier reports whether name lexes as a single identifier
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == name && l.NextToken().Type == token.EOF
+}
+
+// parseExportStatement parses export let <name> = <expression>
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	p.checkTopLevel()
+
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+	stmt.Statement = p.parseLetStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// checkTopLevel reports the current import or export when it's in a block
+func (p *Parser) checkTopLevel() {
+	if p.blockDepth > 0 {
+		msg := fmt.Sprintf("%s: %s is only allowed at the top level",
+			p.curToken.Pos, p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+	}
+}
+
 // parseReturnStatement
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
@@ -236,6 +368,101 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseWhileStatement parses while (<condition>) { <body> }
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseForStatement parses for (<variable> in <iterable>) { <body> }
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, break and continue are allowed in it
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopControlStatement parses break and continue
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s: %s outside of a loop", tok.Pos, tok.Literal)
+		p.errors = append(p.errors, msg)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 // parseExpressionStatement
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	// logging
@@ -317,6 +544,30 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses <target> = <value>, assignments are right-associative
+// so a = b = 1 assigns 1 to b first
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		return nil // the target didn't parse, that's reported already
+	default:
+		msg := fmt.Sprintf("%s: cannot assign to %s", p.curToken.Pos, target.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
 // parseIdentifier
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
@@ -328,8 +579,35 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// too large for an int64, Monkey integers have no limit
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = value
+			return lit
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
+		msg := fmt.Sprintf("%s: could not parse %q as integer", p.curToken.Pos, p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+// parseIllegal reports the problem the lexer found, it's in the literal
+func (p *Parser) parseIllegal() ast.Expression {
+	msg := fmt.Sprintf("%s: %s", p.curToken.Pos, p.curToken.Literal)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("%s: could not parse %q as float", p.curToken.Pos, p.curToken.Literal)
 		p.errors = append(p.errors, msg)
 		return nil
 	}
@@ -386,6 +664,37 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseTryExpression parses try { ... } catch (e) { ... }
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Catch = p.parseBlockStatement()
+
+	return expression
+}
+
 // parseBlockStatement starts with p.curToken being { and parses:
 // - list of Statements while not }
 // */
@@ -393,6 +702,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -420,7 +732,12 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil // syntax error, '{' expected, no body
 	}
+
+	// a loop around the function doesn't reach into its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
@@ -494,6 +811,39 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString parses "a${x}b${y}c" from its STRING_HEAD,
+// STRING_MIDDLE and STRING_TAIL tokens, empty string parts are left out
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	is := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		if p.curToken.Literal != "" {
+			is.Parts = append(is.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if p.curTokenIs(token.STRING_TAIL) {
+			return is
+		}
+
+		if p.peekTokenIs(token.STRING_MIDDLE) || p.peekTokenIs(token.STRING_TAIL) {
+			msg := fmt.Sprintf("%s: empty interpolation", p.peekToken.Pos)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		p.nextToken()
+		part := p.parseExpression(LOWEST)
+		if part == nil {
+			return nil
+		}
+		is.Parts = append(is.Parts, part)
+
+		if p.peekTokenIs(token.STRING_MIDDLE) {
+			p.nextToken()
+		} else if !p.expectPeek(token.STRING_TAIL) {
+			return nil
+		}
+	}
+}
+
 // Arrays
 // parseArrayLiteral
 func (p *Parser) parseArrayLiteral() ast.Expression {
@@ -533,12 +883,35 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseIndexExpression parses arr[i] and the slices arr[start:end],
+// arr[:end], arr[start:] and arr[:]
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken // '['
 
-	p.nextToken() // '['
-	exp.Index = p.parseExpression(LOWEST)
+	var start ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		start = p.parseExpression(LOWEST)
+		if start == nil {
+			return nil
+		}
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: start}
+		}
+	}
 
+	p.nextToken() // ':'
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+		if exp.End == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -546,6 +919,19 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseMemberExpression parses m.name, which is m["name"]
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken // '.'
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	nameTok := token.Token{Type: token.STRING, Literal: p.curToken.Literal, Pos: p.curToken.Pos}
+	index := &ast.StringLiteral{Token: nameTok, Value: nameTok.Literal}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
 // Hashmap
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
@@ -563,6 +949,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"strings"
 	"testing"
 )
 
@@ -152,6 +153,76 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+// literals beyond int64 are parsed as big.Int
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the value of Big, "" if it fits into Value
+	}{
+		{"9223372036854775807", ""},
+		{"9223372036854775808", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if tt.expected == "" {
+			if literal.Big != nil || literal.TokenLiteral() != fmt.Sprint(literal.Value) {
+				t.Errorf("%s: wrong literal. Value=%d, Big=%v", tt.input, literal.Value, literal.Big)
+			}
+			continue
+		}
+		if literal.Big == nil || literal.Big.String() != tt.expected {
+			t.Errorf("%s: literal.Big not %s. got=%v", tt.input, tt.expected, literal.Big)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5", 0.5},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 // Prefix Operators -, !<expression>
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
@@ -366,6 +437,54 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"a + b % c - d",
+			"((a + (b % c)) - d)",
+		},
+		{
+			"a & 1 == 0",
+			"((a & 1) == 0)",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"1 << a + b >> 2",
+			"((1 << a) + (b >> 2))",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
+		{
+			"a = b + c == d",
+			"(a = ((b + c) == d))",
+		},
+		{
+			"a = b = c",
+			"(a = (b = c))",
+		},
+		{
+			"a[i + 1] += f(x) * 2",
+			"((a[(i + 1)]) += (f(x) * 2))",
+		},
+		{
+			"a -= -1",
+			"(a -= (-1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -460,6 +579,298 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestTryExpression(t *testing.T) {
+	input := `try { x + y } catch (err) { err }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Block.Statements) != 1 {
+		t.Fatalf("try block is not 1 statement. got=%d", len(exp.Block.Statements))
+	}
+	block, ok := exp.Block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Block.Statements[0])
+	}
+	if !testInfixExpression(t, block.Expression, "x", "+", "y") {
+		return
+	}
+
+	if !testLiteralExpression(t, exp.Parameter, "err") {
+		return
+	}
+
+	if len(exp.Catch.Statements) != 1 {
+		t.Fatalf("catch block is not 1 statement. got=%d", len(exp.Catch.Statements))
+	}
+	catch, ok := exp.Catch.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Catch.Statements[0])
+	}
+	testIdentifier(t, catch.Expression, "err")
+
+	if exp.String() != "try (x + y) catch (err) err" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []string{
+		`try { 1 }`,
+		`try { 1 } catch { 2 }`,
+		`try { 1 } catch (1) { 2 }`,
+		`try 1 catch (e) { 2 }`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"throw 5;", 5},
+		{"throw \"boom\"", "boom"},
+		{"throw err;", "err"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+		}
+		if stmt.TokenLiteral() != "throw" {
+			t.Fatalf("stmt.TokenLiteral not 'throw', got %q", stmt.TokenLiteral())
+		}
+
+		if str, ok := tt.expectedValue.(string); ok && str == "boom" {
+			lit, ok := stmt.Value.(*ast.StringLiteral)
+			if !ok || lit.Value != "boom" {
+				t.Errorf("stmt.Value is not the string boom. got=%T (%+v)", stmt.Value, stmt.Value)
+			}
+			continue
+		}
+		testLiteralExpression(t, stmt.Value, tt.expectedValue)
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedTarget   string
+		expectedOperator string
+		expectedValue    interface{}
+	}{
+		{"x = 5;", "x", "=", 5},
+		{"x += y;", "x", "+=", "y"},
+		{"arr[1] -= 2", "(arr[1])", "-=", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Target.String() != tt.expectedTarget {
+			t.Errorf("exp.Target is not %q. got=%q", tt.expectedTarget, exp.Target.String())
+		}
+		if exp.Operator != tt.expectedOperator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.expectedOperator, exp.Operator)
+		}
+		testLiteralExpression(t, exp.Value, tt.expectedValue)
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"f() += 1", "1:5: cannot assign to f()"},
+		{"a + b = c", "1:7: cannot assign to (a + b)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	body, ok := stmt.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			stmt.Body.Statements[0])
+	}
+	testIdentifier(t, body.Expression, "x")
+
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Fatalf("Statements[1] is not ast.BreakStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+
+	if stmt.String() != "while ((x < y)) xbreak;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { continue; x }; 5`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	array, ok := stmt.Iterable.(*ast.ArrayLiteral)
+	if !ok || len(array.Elements) != 2 {
+		t.Fatalf("stmt.Iterable is not an array of 2 elements. got=%T (%+v)",
+			stmt.Iterable, stmt.Iterable)
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[0].(*ast.ContinueStatement); !ok {
+		t.Fatalf("Statements[0] is not ast.ContinueStatement. got=%T",
+			stmt.Body.Statements[0])
+	}
+
+	if stmt.String() != "for (x in [1, 2]) continue;x" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`break;`, "1:1: break outside of a loop"},
+		{`if (true) { continue }`, "1:13: continue outside of a loop"},
+		{`while (true) { fn() { break } }`, "1:23: break outside of a loop"},
+		{`for (x [1]) { }`, "1:8: expected next token to be IN, got [ instead"},
+		{`for (1 in [1]) { }`, "1:6: expected next token to be IDENT, got INT instead"},
+		{`while true { }`, "1:7: expected next token to be (, got TRUE instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := `if (x < y) { x } else { y }`
 
@@ -674,6 +1085,76 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"total: ${a + b}"`, `"total: ${(a + b)}"`, 2},
+		{`"${x}"`, `"${x}"`, 1},
+		{`"a${x}b${y}c"`, `"a${x}b${y}c"`, 5},
+		{`"${ {"k": 1}["k"] }!"`, `"${({k:1}[k])}!"`, 2},
+		{`"outer ${"inner ${x}"}"`, `"outer ${"inner ${x}"}"`, 2},
+		{`"\${x}"`, `"${x}"`, 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if tt.parts == 0 {
+			literal, ok := stmt.Expression.(*ast.StringLiteral)
+			if !ok {
+				t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+			}
+			if literal.Value != "${x}" {
+				t.Errorf("literal.Value not %q. got=%q", "${x}", literal.Value)
+			}
+			continue
+		}
+
+		is, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+		if len(is.Parts) != tt.parts {
+			t.Errorf("wrong number of parts for %s. want=%d, got=%d", tt.input, tt.parts, len(is.Parts))
+		}
+		if is.String() != tt.expected {
+			t.Errorf("wrong String(). want=%s, got=%s", tt.expected, is.String())
+		}
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a${}b"`, "1:5: empty interpolation"},
+		{`"a${x y}b"`, "1:7: expected next token to be STRING_TAIL, got IDENT instead"},
+		{`"a${x`, "1:6: expected next token to be STRING_TAIL, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -720,6 +1201,67 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr[1:3]", "(arr[1:3])"},
+		{"arr[:2]", "(arr[:2])"},
+		{"arr[2:]", "(arr[2:])"},
+		{"arr[:]", "(arr[:])"},
+		{"arr[-2:len(arr) - 1]", "(arr[(-2):(len(arr) - 1)])"},
+		{"arr[1:][0]", "((arr[1:])[0])"},
+		{"arr[-1]", "(arr[(-1)])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong String(). want=%s, got=%s", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("arr[:]"))
+	program := p.ParseProgram()
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	slice, ok := stmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+	}
+	if slice.Start != nil || slice.End != nil {
+		t.Errorf("slice bounds are not nil. got=%v and %v", slice.Start, slice.End)
+	}
+}
+
+func TestSliceExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr[1 2]", "1:7: expected next token to be ], got INT instead"},
+		{"arr[1:2:3]", "1:8: expected next token to be ], got : instead"},
+		{"arr[1:", "1:7: no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -910,6 +1452,156 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 //*/
 
 // let helper
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T",
+			stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n",
+			function.Name)
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+		expectedName string
+	}{
+		{`import "math";`, "math", "math"},
+		{`import "lib/strings.mk"`, "lib/strings.mk", "strings"},
+		{`import "../my-lib" as lib;`, "../my-lib", "lib"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T",
+				program.Statements[0])
+		}
+		if stmt.Path != tt.expectedPath {
+			t.Errorf("stmt.Path not %q. got=%q", tt.expectedPath, stmt.Path)
+		}
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name not %q. got=%q", tt.expectedName, stmt.Name.Value)
+		}
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let add = fn(a, b) { a + b };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExportStatement. got=%T",
+			program.Statements[0])
+	}
+	if !testLetStatement(t, stmt.Statement, "add") {
+		return
+	}
+	function, ok := stmt.Statement.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Statement.Value is not ast.FunctionLiteral. got=%T",
+			stmt.Statement.Value)
+	}
+	if function.Name != "add" {
+		t.Errorf("function literal name wrong. want 'add', got=%q", function.Name)
+	}
+}
+
+func TestMemberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"m.x", "(m[x])"},
+		{"m.add(1, 2)", "(m[add])(1, 2)"},
+		{"a.b.c", "((a[b])[c])"},
+		{"-m.x * 2", "((-(m[x])) * 2)"},
+		{"m.xs[0]", "((m[xs])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import math;`, "1:8: expected next token to be STRING, got IDENT instead"},
+		{`import "my-lib";`, "1:1: can't name the module \"my-lib\" after its file, use import \"my-lib\" as <name>"},
+		{`import "lib" as 5;`, "1:17: expected next token to be IDENT, got INT instead"},
+		{`export 5;`, "1:8: expected next token to be LET, got INT instead"},
+		{`fn() { import "lib" }`, "1:8: import is only allowed at the top level"},
+		{`if (true) { export let x = 1; }`, "1:13: export is only allowed at the top level"},
+		{`m.1`, "1:3: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFile("", tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -1032,6 +1724,44 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 }
 
 // parserError helper
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 5;\nlet = 10;", "2:5: expected next token to be IDENT, got = instead"},
+		{"add(1,\n   2;", "2:5: expected next token to be ), got ; instead"},
+		{"let y = 1;\n\n  }", "3:3: no prefix parse function for } found"},
+		{"let s = \"a\\qb\";", "1:9: invalid escape sequence \\q"},
+		{"let s = \"abc", "1:9: unterminated string"},
+		{"\"\\u{110000}\"", "1:1: invalid unicode escape \\u{110000}"},
+		{"1 @ 2", "1:3: illegal character '@'"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFile("", tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong first error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	l := lexer.NewWithFile("script.mk", "let x 5;")
+	p := New(l)
+	p.ParseProgram()
+	if got := p.Errors()[0]; !strings.HasPrefix(got, "script.mk:1:7: ") {
+		t.Errorf("error does not start with the file position. got=%q", got)
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
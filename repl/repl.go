@@ -4,69 +4,190 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/compiler"
-	//"monkey/evaluator"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
 	"monkey/vm"
+	"strings"
 )
 
 const PROMPT = ">>"
 
+// CONTINUATION_PROMPT is shown while an unfinished input is continued on the next line
+const CONTINUATION_PROMPT = ".."
+
+// backends the REPL can execute with
+const (
+	EngineVM   = "vm"
+	EngineEval = "eval"
+)
+
+// LineReader reads a single line of input after showing prompt.
+// It returns io.EOF when the input ends and ErrAborted when the current input was cancelled.
+type LineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
 // REPL - READ EVAL PRINT LOOP
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	//env := object.NewEnvironment()
+func Start(in io.Reader, out io.Writer, engine string) {
+	Run(&scannerReader{scanner: bufio.NewScanner(in), out: out}, out, engine)
+}
 
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalSize)
-	symbolTable := compiler.NewSymbolTable()
+// Run starts the REPL on the lines of the given LineReader.
+// An input with unclosed braces, brackets or parentheses is continued on the next line.
+func Run(lines LineReader, out io.Writer, engine string) {
+	execute := newVMExecutor()
+	if engine == EngineEval {
+		execute = newEvalExecutor()
+	}
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(lines)
+		if err == ErrAborted {
+			continue
+		}
+		if input == "" && err != nil {
 			return
 		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		l := lexer.New(input)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
-			continue
+		} else {
+			execute(out, program)
 		}
 
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readInput reads lines until all opened delimiters are closed
+// returns the input read so far together with the error that ended the input
+func readInput(lines LineReader) (string, error) {
+	var input strings.Builder
+
+	prompt := PROMPT
+	for {
+		line, err := lines.ReadLine(prompt)
+		if err != nil {
+			return input.String(), err
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+
+		if openDelimiters(input.String()) <= 0 {
+			return input.String(), nil
+		}
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+// openDelimiters returns how many ( [ { in input are not closed yet
+func openDelimiters(input string) int {
+	depth := 0
+
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		}
+	}
+	return depth
+}
+
+// scannerReader is a LineReader for plain input like pipes, the prompt is written to out
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// executor runs one parsed line and prints its result,
+// the state of previous lines is kept inside the executor
+type executor func(out io.Writer, program *ast.Program)
+
+func newVMExecutor() executor {
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	loader := module.NewLoader(module.SearchPathFromEnv())
+
+	return func(out io.Writer, program *ast.Program) {
 		comp := compiler.NewWithState(symbolTable, constants)
+		comp.SetLoader(loader)
 		err := comp.Compile(program)
 		if err != nil {
 			fmt.Fprintf(out, "Compilation failed:\n %s\n", err)
-			continue
+			symbolTable.ForgetUnloadedModules(globals)
+			return
 		}
 
 		code := comp.Bytecode()
 		constants = code.Constants
 
 		machine := vm.NewWithGlobalStore(code, globals)
+		machine.SetOutput(out)
 		err = machine.Run()
 		if err != nil {
 			fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
-			continue
+			symbolTable.ForgetUnloadedModules(globals)
+			if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+				io.WriteString(out, runtimeErr.StackTrace())
+			}
+			return
 		}
 
 		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped == nil {
+			return
+		}
 		io.WriteString(out, lastPopped.Inspect())
 		io.WriteString(out, "\n")
+	}
+}
+
+func newEvalExecutor() executor {
+	env := object.NewEnvironment()
+	env.SetImports(object.NewImports(module.NewLoader(module.SearchPathFromEnv())))
 
-		//evaluated := evaluator.Eval(program, env)
-		//if evaluated != nil {
-		//	io.WriteString(out, evaluated.Inspect())
-		//	io.WriteString(out, "\n")
-		//}
+	return func(out io.Writer, program *ast.Program) {
+		env.SetOutput(out)
+		evaluated := evaluator.Eval(program, env)
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
 	}
 }
 
@@ -0,0 +1,75 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenDelimiters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`1 + 2`, 0},
+		{`let f = fn(a) {`, 1},
+		{`let f = fn(a) { [1, (2`, 3},
+		{`let f = fn(a) { a }`, 0},
+		{`"{[("`, 0},
+		{`}`, -1},
+	}
+
+	for _, tt := range tests {
+		if got := openDelimiters(tt.input); got != tt.expected {
+			t.Errorf("openDelimiters(%q) wrong. want=%d, got=%d", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+add(1,
+	2)
+`
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine)
+
+		prompts := strings.Count(out.String(), CONTINUATION_PROMPT)
+		if prompts != 3 {
+			t.Errorf("[%s] wrong number of continuation prompts. want=3, got=%d (%q)",
+				engine, prompts, out.String())
+		}
+		if !strings.Contains(out.String(), "3\n") {
+			t.Errorf("[%s] result of the multi-line call missing in %q", engine, out.String())
+		}
+		if strings.Contains(out.String(), "ERROR") {
+			t.Errorf("[%s] unexpected error in %q", engine, out.String())
+		}
+	}
+}
+
+func TestImportAfterFailedLine(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "math.mk"), []byte(`export let pi = 3;`), 0o644); err != nil {
+		t.Fatalf("could not write module: %s", err)
+	}
+	t.Setenv("MONKEY_PATH", dir)
+
+	// the first line fails after compiling math.mk, before it ran
+	input := "import \"math\"; nope\nimport \"math\" as m\nm.pi * 2\n"
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine)
+
+		if !strings.Contains(out.String(), "6\n") {
+			t.Errorf("[%s] result of the import missing in %q", engine, out.String())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package repl
+
+import (
+	"errors"
+	"os"
+
+	"github.com/peterh/liner"
+)
+
+// ErrAborted is returned by a LineReader when the user cancelled the current input (Ctrl-C)
+var ErrAborted = errors.New("input aborted")
+
+// Terminal reads lines from an interactive terminal with line editing.
+// The history is loaded from historyPath and written back on Close.
+type Terminal struct {
+	state       *liner.State
+	historyPath string
+}
+
+func NewTerminal(historyPath string) *Terminal {
+	state := liner.NewLiner()
+	state.SetCtrlCAborts(true)
+
+	if historyPath != "" {
+		if f, err := os.Open(historyPath); err == nil {
+			state.ReadHistory(f)
+			f.Close()
+		}
+	}
+
+	return &Terminal{state: state, historyPath: historyPath}
+}
+
+func (t *Terminal) ReadLine(prompt string) (string, error) {
+	line, err := t.state.Prompt(prompt)
+	if err == liner.ErrPromptAborted {
+		return "", ErrAborted
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if line != "" {
+		t.state.AppendHistory(line)
+	}
+	return line, nil
+}
+
+// Close restores the terminal and persists the history
+func (t *Terminal) Close() error {
+	var err error
+	if t.historyPath != "" {
+		var f *os.File
+		f, err = os.Create(t.historyPath)
+		if err == nil {
+			_, err = t.state.WriteHistory(f)
+			f.Close()
+		}
+	}
+
+	if closeErr := t.state.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
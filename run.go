@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/vm"
+	"os"
+)
+
+// runFile parses the script at path and executes it with the chosen engine.
+// scriptArgs are bound to the global "args" as an array of strings.
+func runFile(path string, scriptArgs []string, engine string, stdout, stderr io.Writer) int {
+	program, code := parseFile(path, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	args := newArgsArray(scriptArgs)
+
+	if engine == repl.EngineEval {
+		return evalProgram(path, program, args, stdout, stderr)
+	}
+	return runProgram(path, program, args, stdout, stderr)
+}
+
+// parseFile reads and parses the script at path, errors are reported on stderr
+func parseFile(path string, stderr io.Writer) (*ast.Program, int) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return nil, exitUsage
+	}
+	return parseSource(path, string(source), stderr)
+}
+
+// parseSource parses the script source read from path
+func parseSource(path, source string, stderr io.Writer) (*ast.Program, int) {
+	l := lexer.NewWithFile(path, source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintln(stderr, "parser errors:")
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(stderr, "\t%s\n", msg)
+		}
+		return nil, exitParseError
+	}
+	return program, exitOK
+}
+
+func newArgsArray(scriptArgs []string) *object.Array {
+	elements := make([]object.Object, len(scriptArgs))
+	for i, a := range scriptArgs {
+		elements[i] = &object.String{Value: a}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// newLoader returns the loader for the imports of the script at path,
+// modules are looked up in $MONKEY_PATH after the directory of the importer
+func newLoader(path string) *module.Loader {
+	loader := module.NewLoader(module.SearchPathFromEnv())
+	loader.Enter(path)
+	return loader
+}
+
+// evalProgram executes the program read from path with the tree-walking evaluator
+func evalProgram(path string, program *ast.Program, args *object.Array, stdout, stderr io.Writer) int {
+	imports := object.NewImports(newLoader(path))
+	env := object.NewEnvironment()
+	env.SetImports(imports)
+	env.SetOutput(stdout)
+	env.Set("args", args)
+
+	result := evaluator.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok && !errObj.Caught {
+		if imports.IsLoadError(errObj) {
+			// a missing module or an import cycle fails the vm's compiler
+			fmt.Fprintf(stderr, "compilation failed: %s: %s\n", errObj.Pos, errObj.Message)
+			return exitCompileError
+		}
+		fmt.Fprintln(stderr, errObj.Inspect())
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// newSymbolTable returns the global symbol table scripts are compiled with,
+// holding the builtins and the global "args"
+func newSymbolTable() (*compiler.SymbolTable, compiler.Symbol) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	argsSymbol := symbolTable.Define("args")
+	return symbolTable, argsSymbol
+}
+
+// compileProgram compiles the program read from path with the symbols of
+// newSymbolTable
+func compileProgram(path string, program *ast.Program, stderr io.Writer) (*compiler.Bytecode, int) {
+	symbolTable, _ := newSymbolTable()
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetLoader(newLoader(path))
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "compilation failed: %s\n", err)
+		return nil, exitCompileError
+	}
+	return comp.Bytecode(), exitOK
+}
+
+// runProgram compiles the program read from path and executes it in the vm
+func runProgram(path string, program *ast.Program, args *object.Array, stdout, stderr io.Writer) int {
+	bytecode, code := compileProgram(path, program, stderr)
+	if code != exitOK {
+		return code
+	}
+	return runBytecode(bytecode, args, stdout, stderr)
+}
+
+// runBytecode executes bytecode produced by compileProgram in the vm
+func runBytecode(bytecode *compiler.Bytecode, args *object.Array, stdout, stderr io.Writer) int {
+	_, argsSymbol := newSymbolTable()
+
+	globals := make([]object.Object, vm.GlobalSize)
+	globals[argsSymbol.Index] = args
+
+	machine := vm.NewWithGlobalStore(bytecode, globals)
+	machine.SetOutput(stdout)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(stderr, "ERROR: %s\n", err)
+		if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+			io.WriteString(stderr, runtimeErr.StackTrace())
+		}
+		return exitRuntimeError
+	}
+	return exitOK
+}
@@ -1,21 +1,54 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the token starts in the source
+}
+
+// Position is a location in the source, lines and columns start at 1
+type Position struct {
+	File   string // empty when the source didn't come from a file
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position was set by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as file:line:column, or line:column without a file
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 const (
-	ILLEGAL = "ILLEGAL"
+	ILLEGAL = "ILLEGAL" // the literal says what's wrong
 	EOF     = "EOF"
 
 	// Identifiers + literals
 	IDENT  = "IDENT" // add, foobar, x, y, ...
 	INT    = "INT"   // 1343456
+	FLOAT  = "FLOAT" // 3.14, 1e-9
 	STRING = "STRING"
 
+	// a string with interpolations "a${x}b${y}c" is split into
+	// STRING_HEAD "a", x, STRING_MIDDLE "b", y and STRING_TAIL "c"
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -24,8 +57,24 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 
-	LT = "<"
-	GT = ">"
+	PLUS_ASSIGN  = "+="
+	MINUS_ASSIGN = "-="
+
+	PERCENT = "%"
+
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
+
+	AND = "&&"
+	OR  = "||"
+
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
 
 	EQ     = "=="
 	NOT_EQ = "!="
@@ -33,6 +82,7 @@ const (
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	DOT       = "." // m.name is m["name"]
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -49,19 +99,39 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	THROW    = "THROW"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 
 	// Hashes
 	COLON = ":"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"try":      TRY,
+	"catch":    CATCH,
+	"throw":    THROW,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"export":   EXPORT,
 }
 
 // LookupIdent checks the keywords table and returns the TokenType
@@ -6,14 +6,15 @@ import (
 )
 
 type Frame struct {
-	fn *object.CompiledFunction // the compiled function referenced by the frame
-	ip int                      // instruction pointer in THIS frame, for THIS function
+	cl          *object.Closure // the closure referenced by the frame
+	ip          int             // instruction pointer in THIS frame, for THIS function
+	basePointer int             // stack pointer before the call, locals live from here on up
 }
 
-func NewFrame(fn *object.CompiledFunction) *Frame {
-	return &Frame{fn: fn, ip: -1}
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
 
 func (f *Frame) Instructions() code.Instructions {
-	return f.fn.Instructions
+	return f.cl.Fn.Instructions
 }
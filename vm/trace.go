@@ -0,0 +1,114 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/object"
+	"monkey/token"
+)
+
+// RuntimeError is an error of the running program, together with the
+// Monkey stack trace of the frames that were active when it happened
+type RuntimeError struct {
+	Err   error
+	Trace []TraceEntry // innermost call first
+}
+
+// TraceEntry is one active function call of a stack trace
+type TraceEntry struct {
+	Function string         // name of the function, <main> for the program itself
+	Pos      token.Position // the instruction that was executing, or calling the next entry
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// a stack trace shows this many lines of the innermost calls and of the
+// outermost ones, the lines in between are left out
+const (
+	traceHead = 20
+	traceTail = 5
+)
+
+// StackTrace formats the trace with one line per call, innermost first.
+// A call repeated right below itself, like in a recursion, is shown once
+// and very long traces are cut in the middle.
+func (e *RuntimeError) StackTrace() string {
+	lines := []string{}
+	for i := 0; i < len(e.Trace); {
+		entry := e.Trace[i]
+		repeated := 0
+		for i++; i < len(e.Trace) && e.Trace[i] == entry; i++ {
+			repeated++
+		}
+
+		if entry.Pos.IsValid() {
+			lines = append(lines, fmt.Sprintf("\tat %s (%s)\n", entry.Function, entry.Pos))
+		} else {
+			lines = append(lines, fmt.Sprintf("\tat %s\n", entry.Function))
+		}
+		if repeated > 0 {
+			lines = append(lines, fmt.Sprintf("\t... repeated %d more times\n", repeated))
+		}
+	}
+
+	var out bytes.Buffer
+	for i, line := range lines {
+		if len(lines) > traceHead+traceTail && i >= traceHead && i < len(lines)-traceTail {
+			if i == traceHead {
+				fmt.Fprintf(&out, "\t... %d more lines\n", len(lines)-traceHead-traceTail)
+			}
+			continue
+		}
+		out.WriteString(line)
+	}
+	return out.String()
+}
+
+// thrownError is raised by OpThrow and by builtins returning an error
+type thrownError struct {
+	err   *object.Error
+	trace []TraceEntry // frames of the callback that raised it, for builtins like map
+}
+
+func (e *thrownError) Error() string { return e.err.Message }
+
+// errorObject is the error as the catch block sees it
+func (e *RuntimeError) errorObject() *object.Error {
+	errObj := &object.Error{Message: e.Err.Error(), Caught: true}
+	if thrown, ok := e.Err.(*thrownError); ok {
+		errObj.Pos = thrown.err.Pos
+	}
+	if !errObj.Pos.IsValid() && len(e.Trace) > 0 {
+		errObj.Pos = e.Trace[0].Pos
+	}
+	return errObj
+}
+
+// newRuntimeError wraps err with the stack trace of the active frames,
+// below the frames of the callback an error of a builtin came from
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	trace := []TraceEntry{}
+	if thrown, ok := err.(*thrownError); ok {
+		trace = append(trace, thrown.trace...)
+	}
+
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+
+		entry := TraceEntry{Function: fn.Name}
+		switch {
+		case i == 0:
+			entry.Function = "<main>"
+		case fn.Name == "":
+			entry.Function = "<anonymous>"
+		}
+		entry.Pos, _ = fn.Lines.Lookup(frame.ip)
+
+		trace = append(trace, entry)
+	}
+
+	return &RuntimeError{Err: err, Trace: trace}
+}
@@ -2,17 +2,20 @@ package vm
 
 import (
 	"fmt"
+	"io"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
+	"os"
+	"strings"
 )
 
-const StackSize = 2048
+const StackSize = 1 << 16
 const GlobalSize = 65536
-const MaxFrames = 1024
+const MaxFrames = 1 << 14 // calls nested deeper than this are a frame overflow
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
+var True = object.True
+var False = object.False
 var Null = &object.Null{}
 
 // VM
@@ -23,17 +26,30 @@ type VM struct {
 	stack []object.Object // objects in the stack
 	sp    int             // Always points to the next value. Top of stack is stack[sp-1]
 
-	globals []object.Object
+	globals     []object.Object
+	globalNames []string // names of the global slots, for errors
 
 	frames      []*Frame // the instruction pointer "ip" is now part of the frame
 	framesIndex int
+
+	out io.Writer // where builtins like puts print
+
+	// the error the last failed callback of a builtin returned, and the
+	// frames of the callback it was raised in, innermost first
+	callbackErr   *object.Error
+	callbackTrace []TraceEntry
 }
 
 // takes the bytecode from the compiler
 // returns a vm from that bytecode
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainFrame := NewFrame(mainFn) // add main function to main frame
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0) // add main function to main frame
 
 	frames := make([]*Frame, MaxFrames) // create frames array
 	frames[0] = mainFrame               // push mainFrame to index 0
@@ -44,10 +60,13 @@ func New(bytecode *compiler.Bytecode) *VM {
 		stack: make([]object.Object, StackSize),
 		sp:    0,
 
-		globals: make([]object.Object, GlobalSize),
+		globals:     make([]object.Object, GlobalSize),
+		globalNames: bytecode.Globals,
 
 		frames:      frames, // set out frames
 		framesIndex: 1,      // and init the index for our next frame (current is 0)
+
+		out: os.Stdout,
 	}
 }
 
@@ -57,6 +76,11 @@ func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// SetOutput sets where builtins like puts print, os.Stdout by default
+func (vm *VM) SetOutput(out io.Writer) {
+	vm.out = out
+}
+
 // returns the object on top of the stack
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
@@ -65,6 +89,24 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// globalName returns the name of the global slot index, or its index when
+// the bytecode came without names
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+// variableName returns the name of a local or free variable by index,
+// falls back to the kind and index for bytecode without the names
+func variableName(names []string, index int, kind string) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return fmt.Sprintf("%s %d", kind, index)
+}
+
 // push an object onto the stack
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
@@ -91,15 +133,104 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	// so vm.sp is the last popped object
 }
 
+// Run executes the bytecode, errors that aren't caught are returned as *RuntimeError
+func (vm *VM) Run() error {
+	return vm.runFrames(0)
+}
+
+// Call calls fn with args and runs it to completion while the vm is running,
+// builtins like map use it to call back into Monkey code. The stack and the
+// frames are left as they were, also when the call fails.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	base, sp := vm.framesIndex, vm.sp
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err != nil {
+		vm.framesIndex, vm.sp = base, sp
+		return nil, vm.newRuntimeError(err)
+	}
+
+	// a builtin is done already, a closure has pushed its frame
+	if err := vm.runFrames(base); err != nil {
+		vm.framesIndex, vm.sp = base, sp
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// callFunction is the Call the builtins get, an error is thrown again
+// by the builtin. The frames of the callback are kept for the stack trace
+// of the error the builtin returns.
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) object.Object {
+	base := vm.framesIndex
+	result, err := vm.Call(fn, args...)
+	if err != nil {
+		runtimeErr := err.(*RuntimeError)
+		errObj := runtimeErr.errorObject()
+		errObj.Caught = false
+
+		vm.callbackErr = errObj
+		vm.callbackTrace = runtimeErr.Trace[:len(runtimeErr.Trace)-base]
+		return errObj
+	}
+	return result
+}
+
+// runFrames runs until the frames above base have returned, catching
+// errors in them. Errors that aren't caught there are returned.
+func (vm *VM) runFrames(base int) error {
+	for {
+		err := vm.run(base)
+		if err == nil {
+			return nil
+		}
+
+		runtimeErr := vm.newRuntimeError(err)
+		if !vm.catch(runtimeErr, base) {
+			return runtimeErr
+		}
+	}
+}
+
+// catch unwinds the frames above base to the innermost handler covering the
+// failed instruction, and pushes the error for its catch block
+func (vm *VM) catch(err *RuntimeError, base int) bool {
+	for i := vm.framesIndex - 1; i >= base; i-- {
+		frame := vm.frames[i]
+		handler, ok := frame.cl.Fn.Handlers.Lookup(frame.ip)
+		if !ok {
+			continue
+		}
+
+		vm.framesIndex = i + 1
+		vm.sp = frame.basePointer + frame.cl.Fn.NumLocals + handler.Depth
+		frame.ip = handler.Target - 1
+
+		vm.push(err.errorObject())
+		return true
+	}
+	return false
+}
+
 // FETCH-DECODE-EXECUTE cycle
 // iterate through vm.instructions by incrementing the instruction pointer
-func (vm *VM) Run() error {
+// it stops when the frame at base returns, for the main frame that's never
+func (vm *VM) run(base int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
 	// execute OpCodes, while the instruction pointer is not at the end of the instruction stack
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > base && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++ // increment the instruction pointer in the current frame
 
 		ip = vm.currentFrame().ip
@@ -120,7 +251,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -138,7 +270,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+			code.OpLessThan, code.OpLessEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -177,6 +310,70 @@ func (vm *VM) Run() error {
 			}
 			// if true, we do nothing and run the consequence
 
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, val)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			// every push moves the next value to copy to sp-n
+			for i := 0; i < n; i++ {
+				err := vm.push(vm.stack[vm.sp-n])
+				if err != nil {
+					return err
+				}
+			}
+
+		// loops
+		case code.OpIter:
+			iterable := vm.pop()
+			it, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("not iterable: %s", iterable.Type())
+			}
+			err := vm.push(it)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it, ok := vm.stack[vm.sp-1].(*object.Iterator)
+			if !ok {
+				return fmt.Errorf("vm: OpIterNext: not an iterator")
+			}
+			element, ok := it.Next()
+			if !ok {
+				// done, drop the iterator and leave the loop
+				vm.pop()
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			err := vm.push(element)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJumpIfFalsyOrPop, code.OpJumpIfTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// && stops at a falsy value, || at a truthy one
+			if isTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpIfTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -193,7 +390,12 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2 // skip 2 byte operands
 
-			err := vm.push(vm.globals[globalIndex])
+			global := vm.globals[globalIndex]
+			if global == nil {
+				// the let statement of a hoisted function didn't run yet
+				return fmt.Errorf("identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -210,6 +412,20 @@ func (vm *VM) Run() error {
 				return fmt.Errorf("vm: Run(OpArray): failed to push array to stack. %s", err)
 			}
 
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(part.Inspect())
+			}
+			vm.sp -= numParts
+
+			if err := vm.push(&object.String{Value: out.String()}); err != nil {
+				return err
+			}
+
 		case code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -225,6 +441,23 @@ func (vm *VM) Run() error {
 				return fmt.Errorf("vm: Run(): failed to push hash to stack. %s", err)
 			}
 
+		case code.OpModule:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			numExports := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			exports, err := vm.buildHash(vm.sp-2*numExports, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= 2 * numExports
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			err = vm.push(&object.Module{Name: name, Exports: exports})
+			if err != nil {
+				return err
+			}
+
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -234,18 +467,33 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			result, err := object.Slice(left, start, end)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
 		case code.OpCall:
-			fn, ok := vm.stack[vm.sp-1].(*object.CompiledFunction)
-			if !ok {
-				return fmt.Errorf("calling non-function")
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
 			}
-			frame := NewFrame(fn)
-			vm.pushFrame(frame)
 
 		case code.OpReturnValue:
 			returnValue := vm.pop()
-			vm.popFrame()
-			vm.pop()
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1 // drop the locals and the function itself
 
 			err := vm.push(returnValue)
 			if err != nil {
@@ -253,14 +501,125 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpReturn:
-			vm.popFrame()
-			vm.pop()
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
 
 			err := vm.push(Null)
 			if err != nil {
 				return err
 			}
 
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1 // skip 1 byte operand
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop() // a captured local, the closures see the value
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			local := load(vm.stack[frame.basePointer+int(localIndex)])
+			if local == nil {
+				return fmt.Errorf("identifier not found: %s",
+					variableName(frame.cl.Fn.LocalNames, int(localIndex), "local"))
+			}
+			err := vm.push(local)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// the first capture moves the local into a cell
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			err := vm.push(cell)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3 // skip 2 byte constant index and 1 byte free count
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			free := load(currentClosure.Free[freeIndex])
+			if free == nil {
+				return fmt.Errorf("identifier not found: %s",
+					variableName(currentClosure.Fn.FreeNames, int(freeIndex), "free variable"))
+			}
+			err := vm.push(free)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			cell, ok := currentClosure.Free[freeIndex].(*object.Cell)
+			if !ok {
+				return fmt.Errorf("vm: OpSetFree: not a cell")
+			}
+			cell.Value = vm.pop()
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// pass the cell on, the nested closure shares it
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
+
+		case code.OpThrow:
+			return &thrownError{err: object.NewThrownError(vm.pop())}
+
 		default:
 			op_code, _ := code.Lookup(byte(op))
 			errString := fmt.Sprintf("VM: run(): Encountered unknown OpCode: %v", op_code)
@@ -290,6 +649,100 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.framesIndex]
 }
 
+// executeCall calls the closure or builtin sitting below its numArgs arguments on the stack
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function and non-built-in")
+	}
+}
+
+// callClosure pushes a new frame for cl, its arguments become the first locals
+//
+//	+-----------+-------+-----+-------+--------+
+//	| closure   | arg 0 | ... | arg n | locals |
+//	+-----------+-------+-----+-------+--------+
+//	            ^ basePointer
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("vm: frame overflow")
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs) // the arguments become the first locals
+	if frame.basePointer+cl.Fn.NumLocals > StackSize {
+		return fmt.Errorf("vm: stack overflow")
+	}
+	vm.pushFrame(frame)
+
+	// reserve the rest of the locals on the stack, cleared so nothing of an
+	// earlier call shows through before their let statements ran
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// callBuiltin runs the Go function directly and replaces callee and arguments with its result
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Call(vm.callFunction, vm.out, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok && !errObj.Caught {
+		thrown := &thrownError{err: errObj}
+		if errObj == vm.callbackErr {
+			thrown.trace = vm.callbackTrace
+		}
+		vm.callbackErr, vm.callbackTrace = nil, nil
+		return thrown
+	}
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+// pushClosure wraps the CompiledFunction constant into a Closure,
+// taking the numFree topmost stack elements as its free variables
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// load returns the value of a local or free variable, unwrapping the cell
+// of a captured one, nil if it wasn't assigned yet
+func load(variable object.Object) object.Object {
+	if cell, ok := variable.(*object.Cell); ok {
+		return cell.Value
+	}
+	return variable
+}
+
 // END FRAMES
 
 func isTruthy(obj object.Object) bool {
@@ -305,6 +758,21 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// binaryOperators are the operators of the binary opcodes, as package object
+// names them
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:        "+",
+	code.OpSub:        "-",
+	code.OpMul:        "*",
+	code.OpDiv:        "/",
+	code.OpMod:        "%",
+	code.OpBitAnd:     "&",
+	code.OpBitOr:      "|",
+	code.OpBitXor:     "^",
+	code.OpShiftLeft:  "<<",
+	code.OpShiftRight: ">>",
+}
+
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -313,8 +781,19 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	rightType := right.Type()
 
 	if leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ {
-		// return a possible error when pushing the result
-		return vm.executeBinaryIntegerOperation(op, left, right)
+		result, err := object.IntegerOperation(binaryOperators[op], left, right)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	}
+	if object.IsNumber(left) && object.IsNumber(right) {
+		// an integer mixed with a float is promoted to float
+		result, err := object.FloatOperation(binaryOperators[op], left, right)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
 	}
 	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
 		return vm.executeBinaryStringOperation(op, left, right)
@@ -325,31 +804,6 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 
 }
 
-func (vm *VM) executeBinaryIntegerOperation(
-	op code.Opcode,
-	left, right object.Object,
-) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	var result int64
-
-	switch op {
-	case code.OpAdd:
-		result = leftValue + rightValue
-	case code.OpSub:
-		result = leftValue - rightValue
-	case code.OpMul:
-		result = leftValue * rightValue
-	case code.OpDiv:
-		result = leftValue / rightValue
-	default:
-		return vm.push(&object.Integer{Value: result})
-	}
-	// return a possible error when pushing the result
-	return vm.push(&object.Integer{Value: result})
-}
-
 func (vm *VM) executeBinaryStringOperation(
 	op code.Opcode,
 	left, right object.Object,
@@ -376,35 +830,72 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 
 	// manage integer comparison
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return vm.executeIntegerComparison(op, left, right)
+		return vm.executeOrderedComparison(op, left, right)
+	}
+	if object.IsNumber(left) && object.IsNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeOrderedComparison(op, left, right)
 	}
 
-	// just manage booleans
+	// everything else can only be equal or not
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)",
 			op, left.Type(), right.Type())
 	}
 }
 
-func (vm *VM) executeIntegerComparison(
+func (vm *VM) executeFloatComparison(
 	op code.Opcode,
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	leftValue, _ := object.FloatValue(left)
+	rightValue, _ := object.FloatValue(right)
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+// executeOrderedComparison orders integers by value and strings by code point
+func (vm *VM) executeOrderedComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	cmp, _ := object.Compare(left, right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp >= 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(cmp < 0))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp <= 0))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -415,26 +906,72 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.Error).Field(index.(*object.String).Value); ok {
+			return vm.push(field)
+		}
+		return vm.push(Null)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		mod := left.(*object.Module)
+		if export, ok := mod.Export(index.(*object.String).Value); ok {
+			return vm.push(export)
+		}
+		return fmt.Errorf("module %s has no export %s", mod.Name, index.Inspect())
 	default:
 		return fmt.Errorf("vm: executeIndexExpression: index operator not supported: %s", left.Type())
 	}
 }
 
+// executeSetIndex sets the element of an array or hash in place and pushes the value
+func (vm *VM) executeSetIndex(left, index, val object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i, ok := object.SequenceIndex(index, len(elements))
+		if !ok {
+			return fmt.Errorf("index out of range: %s", index.Inspect())
+		}
+		elements[i] = val
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Set(key, val)
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return vm.push(val)
+}
+
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
-	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	elements := array.(*object.Array).Elements
 
-	if i < 0 || i > max {
+	i, ok := object.SequenceIndex(index, len(elements))
+	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(arrayObject.Elements[i])
+	return vm.push(elements[i])
 	// an OpIndex should always follow a pop operator that takes the element from the stack
 }
 
+// executeStringIndex pushes the code point at index as a string
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	runes := []rune(str.(*object.String).Value)
+
+	i, ok := object.SequenceIndex(index, len(runes))
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(runes[i])})
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
@@ -443,12 +980,12 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 		return fmt.Errorf("vm: executeHashIndex: %s is not a Hashable key", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return vm.push(Null) // key doesn't exist
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 func (vm *VM) executeBangOperator() error {
@@ -469,12 +1006,14 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		return vm.push(object.NegateInteger(operand))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("vm: unsupported type for negation: %s", operand.Type())
 	}
-
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -499,26 +1038,20 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 
 // hash
 
-func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+func (vm *VM) buildHash(startIndex, endIndex int) (*object.Hash, error) {
+	hash := object.NewHash((endIndex - startIndex) / 2)
 
 	for i := startIndex; i < endIndex; i += 2 {
-		// get values from the stack bottom up
+		// get values from the stack bottom up, that's the order of the literal
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		// build HashPair
-		pair := object.HashPair{Key: key, Value: value}
-
-		// generate a HashKey from the key
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
 			return nil, fmt.Errorf("vm: buildHash: unusable as hash key: %s", key.Type())
 		}
 
-		// build a list of hashpairs attached to our integer HashKey
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
-	// return a list of hashpairs (indexed by our int64 HashKey)
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
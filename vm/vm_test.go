@@ -2,11 +2,17 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/compiler"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +47,13 @@ func runVMTests(t *testing.T, tests []vmTestCase) {
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+		if expectedErr, ok := tt.expected.(*object.Error); ok && err != nil {
+			// errors that weren't caught end the program
+			if err.Error() != expectedErr.Message {
+				t.Errorf("vm: runTests: wrong vm error. want=%q, got=%q", expectedErr.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm: runTests: vm error: %s", err)
 		}
@@ -70,6 +83,81 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 + 2 & 3", 3},
+		{"2 * 3 % 4", 2},
+		{"1 << 2 + 1", 5},
+		{"(1 | 2) ^ 7", 4},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"0.25 + 0.5", 0.75},
+		{"5 / 2.0", 2.5},
+		{"2.0 * 3", 6.0},
+		{"1 - 0.5", 0.5},
+		{"7.5 % 2", 1.5},
+		{"1.0 / 0", math.Inf(1)},
+		{"1 < 1.5", true},
+		{"1.5 <= 1", false},
+		{"2.0 == 2", true},
+		{"2.5 != 2.5", false},
+		{"2.5 >= 3", false},
+		{"{1: 5}[1.0]", 5},
+		{"{2.5: 5}[2.5]", 5},
+		{"int(2.9) + int(-2.9)", 0},
+		{"float(5) / 2", 2.5},
+		{"float(\"1e-3\")", 0.001},
+		{"try { 0.5 & 1 } catch (e) { e[\"message\"] }", "unknown operator: FLOAT & INTEGER"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{"9223372036854775808", bigInt("9223372036854775808")},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"-9223372036854775808 == -9223372036854775807 - 1", true},
+		{"-9223372036854775807 - 2", bigInt("-9223372036854775809")},
+		{"4294967296 * 4294967296", bigInt("18446744073709551616")},
+		{"1 << 64", bigInt("18446744073709551616")},
+		{"(-9223372036854775807 - 1) / -1", bigInt("9223372036854775808")},
+		{"-(-9223372036854775807 - 1)", bigInt("9223372036854775808")},
+		{"(1 << 100) + 1 - (1 << 100)", 1},
+		{"(1 << 100) / (1 << 98)", 4},
+		{"(1 << 100) % 7", 2},
+		{"(1 << 100) >> 98", 4},
+		{"-(1 << 100) >> 200", -1},
+		{"(1 << 64) & 1", 0},
+		{"(1 << 64) | 1", bigInt("18446744073709551617")},
+		{"(1 << 100) > 9223372036854775807", true},
+		{"(1 << 64) == (1 << 64)", true},
+		{"(1 << 64) != 1", true},
+		{"-(1 << 64) <= -1", true},
+		{"(1 << 64) * 0.5", 9223372036854775808.0},
+		{"{(1 << 64): 1}[1 << 64]", 1},
+		{"[1][1 << 64]", Null},
+		{"int(1e30)", bigInt("1000000000000000019884624838656")},
+		{`int("123456789012345678901234567890")`, bigInt("123456789012345678901234567890")},
+		{"try { 1 / 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { (1 << 64) / 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { (1 << 64) % 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { 1 << (1 << 64) } catch (e) { e[\"message\"] }", "shift count too large: 18446744073709551616"},
+		{"try { (1 << 64) << -1 } catch (e) { e[\"message\"] }", "negative shift count: -1"},
 	}
 
 	runVMTests(t, tests)
@@ -104,6 +192,74 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!false", false},
 		{"!!5", true},
 		{"!(if (false) {5;})", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1 | 2 == 3", true},
+		{"6 & 1 == 0", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 <= 3 || false", true},
+	}
+
+	runVMTests(t, tests)
+}
+
+// the operands of a comparison are evaluated left to right, whatever the operator
+func TestComparisonOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`let log = ""; let l = fn() { log += "l"; 1 }; let r = fn() { log += "r"; 2 }; l() < r(); l() <= r(); r() > l(); log`, "lrlrrl"},
+		{`let i = 0; let a = [1, 2, 3]; a[i += 1] < a[i += 1]`, true},
+		{`let i = 0; let a = [3, 2, 1]; a[i += 1] <= a[i += 1]`, false},
+		{`1.5 < 2`, true},
+		{`2 <= 1.5`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`1 < 9223372036854775807 + 1`, true},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		// the result is the operand that decided it
+		{"5 && 6", 6},
+		{"false && 6", false},
+		{"if (false) { 1 } && 6", Null},
+		{"0 || 6", 0},
+		{"if (false) { 1 } || 6", 6},
+		{`"" || "x"`, ""},
+		// the right side is only evaluated when it's needed
+		{"false && (1 + true)", false},
+		{"true || (1 + true)", true},
+		{"let n = 0; let f = fn(x) { n += 1; x }; f(false) && f(true); f(true) || f(true); n", 2},
+		{"1 + (false || 2) * 3", 7},
+		{"[true && 1, false || 2]", []int{1, 2}},
+		{"let x = 0; while (x < 10 && x != 5) { x += 1 }; x", 5},
+		{"try { 1 % 0 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { 1 << -1 } catch (e) { e[\"message\"] }", "negative shift count: -1"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${1}${"a"}${true}"`, "1atrue"},
+		{`"list ${[1, "x"]} and ${2.5 * 2}!"`, "list [1,x] and 5.0!"},
+		{`let f = fn(n) { "n=${n}" }; f(7) + "."`, "n=7."},
+		{`"outer ${"inner ${1 + 1}"}"`, "outer inner 2"},
+		{`"${ {"k": "v"}["k"] }"`, "v"},
+		{`"cost: \${x}"`, "cost: ${x}"},
+		{`format("%s is %d years", "Kim", 30)`, "Kim is 30 years"},
+		{`format("%6.2f|%-4v|", 3.14159, true)`, "  3.14|true|"},
+		{`try { format("%d", "x") } catch (e) { e["message"] }`, "argument 2 to `format` must be INTEGER, got STRING"},
+		{`try { "${1 + true}" } catch (e) { e["message"] }`, "unsupported types for binary operation: INTEGER BOOLEAN"},
 	}
 
 	runVMTests(t, tests)
@@ -142,6 +298,15 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key"+"banana"`, "monkeybanana"},
+		{`"a\tb"`, "a\tb"},
+		{`"\u{1F600}"`, "\U0001F600"},
+		{`len("日本語")`, 3},
+		{`len("\u{1F600}!")`, 2},
+		{`"日本語"[1]`, "本"},
+		{`"héllo"[4]`, "o"},
+		{`"abc"[3]`, Null},
+		{`let größe = "ö"; größe + größe`, "öö"},
+		{`let n = 0; for (c in "añb") { n += 1 }; n`, 3},
 	}
 
 	runVMTests(t, tests)
@@ -186,7 +351,9 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1,2,3]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1,2,3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-3]", 1},
+		{"[1][-2]", Null},
 		{"{1:1, 2:2}[1]", 1},
 		{"{1:1, 2:2}[2]", 2},
 		{"{1:1}[0]", Null},
@@ -196,6 +363,32 @@ func TestIndexExpressions(t *testing.T) {
 	runVMTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][5:]", []int{}},
+		{"[1, 2, 3][(1 << 64):]", []int{}},
+		{"let a = [1, 2, 3]; let b = a[:]; b[0] = 9; a[0]", 1},
+		{`"hällo"[1:3]`, "äl"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"monkey"[-1]`, "y"},
+		{`"abc"[5:]`, ""},
+		{`let s = "abcdef"; s[1:len(s) - 1]`, "bcde"},
+		{`try { [1][1:"x"] } catch (e) { e["message"] }`, "slice index must be INTEGER, got STRING"},
+		{`try { {}[1:] } catch (e) { e["message"] }`, "slice operator not supported: HASH"},
+	}
+
+	runVMTests(t, tests)
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -284,6 +477,924 @@ func TestFirstClassFunctions(t *testing.T) {
 	runVMTests(t, tests)
 }
 
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let one = fn() { let one = 1; one };
+			one();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			oneAndTwo();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let firstFoobar = fn() { let foobar = 50; foobar; };
+			let secondFoobar = fn() { let foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+			expected: 150,
+		},
+		{
+			input: `
+			let globalSeed = 50;
+			let minusOne = fn() { let num = 1; globalSeed - num; }
+			let minusTwo = fn() { let num = 2; globalSeed - num; }
+			minusOne() + minusTwo();
+			`,
+			expected: 97,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let identity = fn(a) { a; };
+			identity(4);
+			`,
+			expected: 4,
+		},
+		{
+			input: `
+			let sum = fn(a, b) { a + b; };
+			sum(1, 2);
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let sum = fn(a, b) { let c = a + b; c; };
+			sum(1, 2) + sum(3, 4);
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let sum = fn(a, b) { let c = a + b; c; };
+			let outer = fn() { sum(1, 2) + sum(3, 4); };
+			outer();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let globalNum = 10;
+			let sum = fn(a, b) { let c = a + b; c + globalNum; };
+			let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+			outer() + globalNum;
+			`,
+			expected: 50,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a) { a; }();`,
+			expected: `wrong number of arguments: want=1, got=0`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("vm: compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("vm: expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("vm: wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+		expectedTrace string
+	}{
+		{
+			input:         "1 +\n  true",
+			expectedError: "unsupported types for binary operation: INTEGER BOOLEAN",
+			expectedTrace: "\tat <main> (1:3)\n",
+		},
+		{
+			input: `
+let add = fn(a, b) {
+  a + b
+};
+let twice = fn(f) { f(1, true) };
+twice(add);`,
+			expectedError: "unsupported types for binary operation: INTEGER BOOLEAN",
+			expectedTrace: "\tat add (3:5)\n\tat twice (5:22)\n\tat <main> (6:6)\n",
+		},
+		{
+			input:         "let f = fn(a) { a };\nfn() { f() }()",
+			expectedError: "wrong number of arguments: want=1, got=0",
+			expectedTrace: "\tat <anonymous> (2:9)\n\tat <main> (2:13)\n",
+		},
+		{
+			// the frames of a callback stay in the trace of the builtin calling it
+			input:         "let f = fn(x) {\n  x / 0\n};\nmap([1, 2], f)",
+			expectedError: "division by zero",
+			expectedTrace: "\tat f (2:5)\n\tat <main> (4:4)\n",
+		},
+		{
+			// a recursion shows up once
+			input:         "let deep = fn(n) {\n  if (n == 0) { 1 + true } else { deep(n - 1) }\n};\ndeep(3)",
+			expectedError: "unsupported types for binary operation: INTEGER BOOLEAN",
+			expectedTrace: "\tat deep (2:19)\n\tat deep (2:39)\n\t... repeated 2 more times\n\tat <main> (4:5)\n",
+		},
+		{
+			input:         "let deep = fn(n) { deep(n + 1) };\ndeep(0)",
+			expectedError: "vm: frame overflow",
+			expectedTrace: "\tat deep (1:24)\n\t... repeated 16382 more times\n\tat <main> (2:5)\n",
+		},
+		{
+			// mutual recursion doesn't repeat a line right away, the middle is cut
+			input:         "let ping = fn(n) { pong(n + 1) };\nlet pong = fn(n) { ping(n + 1) };\nping(0)",
+			expectedError: "vm: frame overflow",
+			expectedTrace: strings.Repeat("\tat ping (1:24)\n\tat pong (2:24)\n", traceHead/2) +
+				fmt.Sprintf("\t... %d more lines\n", MaxFrames-traceHead-traceTail) +
+				"\tat pong (2:24)\n\tat ping (1:24)\n\tat pong (2:24)\n\tat ping (1:24)\n\tat <main> (3:5)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("vm: compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("vm: expected a *RuntimeError. got=%T (%v)", err, err)
+		}
+
+		if runtimeErr.Error() != tt.expectedError {
+			t.Errorf("vm: wrong VM error: want=%q, got=%q", tt.expectedError, runtimeErr)
+		}
+		if runtimeErr.StackTrace() != tt.expectedTrace {
+			t.Errorf("vm: wrong stack trace:\nwant=%q\ngot=%q", tt.expectedTrace, runtimeErr.StackTrace())
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`try { throw 5 } catch (e) { e["message"] }`, "5"},
+		{"let x = 1;\ntry {\n  x + true } catch (e) { [e[\"line\"], e[\"column\"]] }", []int{3, 5}},
+		{`try { 1 } catch (e) { 2 }; 3`, 3},
+		{`try { } catch (e) { 2 }`, Null},
+		{`try { throw "x" } catch (e) { }`, Null},
+		{`try { throw "x" } catch (e) { e["nothing"] }`, Null},
+		// values below the try block stay on the stack
+		{`1 + try { [2, 3 + true] } catch (e) { 10 }`, 11},
+		{`[1, try { 2 + [3, 4][true] } catch (e) { 5 }, 6]`, []int{1, 5, 6}},
+		// unwinding across frames
+		{`
+		let inner = fn(x) { if (x > 1) { throw "too big" }; x };
+		let middle = fn(x) { 1 + inner(x) };
+		try { middle(1) + middle(5) } catch (e) { e["message"] }
+		`, "too big"},
+		{`
+		let safe = fn(x) { try { 10 / x + [true][0] + 1 } catch (e) { -1 } };
+		[safe(2), safe(5)]
+		`, []int{-1, -1}},
+		{`
+		let f = fn(a) {
+			let b = 2;
+			let r = try { a + b + true } catch (e) { a * b };
+			r + 1
+		};
+		f(3)
+		`, 7},
+		// nested try blocks, rethrowing
+		{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e["message"] }`, "inner"},
+		{`try { try { throw "inner" } catch (e) { 1 } } catch (e) { 2 }`, 1},
+		{`try { try { 1 } catch (e) { 2 }; throw "outer" } catch (e) { e["message"] }`, "outer"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, 1},
+		// caught errors are ordinary values
+		{`let e = try { throw "x" } catch (e) { e }; [e][0]["message"]`, "x"},
+		{`throw "uncaught"`, &object.Error{Message: "uncaught"}},
+		{`try { 1 } catch (e) { 2 }; 1 + true`,
+			&object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{`let x = 1; x = 2; x`, 2},
+		{`let x = 1; x = x + 1`, 2},
+		{`let x = 10; x += 5; x -= 3; x`, 12},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		// assignments update the variable where it's defined
+		{`let count = 0; let inc = fn() { count += 1; }; inc(); inc(); count`, 2},
+		{`let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x`, 7},
+		{`let f = fn(n) { n += 1; n }; f(1)`, 2},
+		{`let f = fn() { let i = 0; let sum = 0; while (i < 4) { i += 1; sum += i; }; sum }; f()`, 10},
+		// elements of arrays and hashes are set in place
+		{`let a = [1, 2, 3]; a[0] = 5; a`, []int{5, 2, 3}},
+		{`let a = [1, 2, 3]; a[2] += 10; a[2]`, 13},
+		{`let a = [1, 2]; let b = a; b[0] = 9; a`, []int{9, 2}},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] -= 1; [h["a"], h["b"]]`, []int{0, 2}},
+		{`let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]`, 3},
+		{`let a = [[1], [2]]; a[1][0] = 7; a[1]`, []int{7}},
+		{`let a = [0, 0]; (a[1] = 4) + 1`, 5},
+		// the index is evaluated once
+		{`let i = 0; let next = fn() { i += 1; i }; let a = [0, 0, 0]; a[next()] += 5; [i, a[1]]`, []int{1, 5}},
+		{`let a = [1]; try { a[1] = 2 } catch (e) { e["message"] }`, "index out of range: 1"},
+		{`let a = [1, 2]; a[-1] = 5; a[1]`, 5},
+		{`let a = [1]; try { a[-2] = 2 } catch (e) { e["message"] }`, "index out of range: -2"},
+		{`try { "abc"[0] = "x" } catch (e) { e["message"] }`, "index assignment not supported: STRING"},
+		{`let h = {}; try { h[[1]] = 1 } catch (e) { e["message"] }`, "unusable as hash key: ARRAY"},
+		// captured variables are shared by the function and its closures
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c()`, 2},
+		{`let f = fn() { let c = 0; fn() { c += 1; c } }; let g = f(); g(); g()`, 2},
+		{`let f = fn() { let n = 1; let get = fn() { n }; n = 5; get() }; f()`, 5},
+		{`let f = fn() { let n = 1; let set = fn() { n = 7 }; set(); n }; f()`, 7},
+		{`let f = fn() { let n = 0; let inc = fn() { fn() { n += 1 } }; inc()(); inc()(); n }; f()`, 2},
+		{`let f = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let p = f(); p[0](); p[0](); p[1]()`, 2},
+		{`let f = fn() { let fs = []; let i = 0; while (i < 3) { let x = i; fs = push(fs, fn() { x }); i += 1 }; fs[0]() + fs[2]() }; f()`, 4},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let i = 0; while (i < 5) { let i = i + 1; }; i`, 5},
+		{`let i = 0; while (false) { let i = 1; }; i`, 0},
+		{`let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i`, 3},
+		{`
+		let i = 0;
+		let sum = 0;
+		while (i < 6) {
+			let i = i + 1;
+			if (i == 2) { continue; }
+			let sum = sum + i;
+		};
+		sum
+		`, 19},
+		{`let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum`, 6},
+		{`let sum = 0; for (x in []) { let sum = 1; }; sum`, 0},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{`let n = 0; for (k in {"a": 1, "b": 2}) { let n = n + 1; }; n`, 2},
+		{`let last = 0; for (x in [1, 2, 3, 4]) { if (x > 2) { break }; let last = x; }; last`, 2},
+		{`let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue }; let sum = sum + x; }; sum`, 8},
+		// nested loops, break and continue leave the inner one
+		{`
+		let count = 0;
+		for (x in [1, 2, 3]) {
+			for (y in [1, 2, 3]) {
+				if (y > x) { break; }
+				let count = count + 1;
+			}
+		};
+		count
+		`, 6},
+		// break out of an expression that already pushed values
+		{`
+		let sum = 0;
+		for (x in [1, 2, 3]) { let sum = sum + 10 * if (x == 2) { break } else { x }; };
+		sum
+		`, 10},
+		{`let sum = 0; for (x in [1, 2]) { let sum = sum + [x, if (x == 1) { continue } else { x }][1]; }; sum`, 2},
+		// loops in functions
+		{`
+		let find = fn(xs, limit) {
+			for (x in xs) {
+				if (x > limit) { return x; }
+			}
+			-1
+		};
+		[find([1, 5, 9], 4), find([1, 2], 4)]
+		`, []int{5, -1}},
+		{`
+		let count = fn(n) {
+			let i = 0;
+			while (i < n) { let i = i + 1; }
+			i
+		};
+		count(2000)
+		`, 2000},
+		{`let f = fn() { for (x in [1, 2]) { try { throw x } catch (e) { continue } }; 3 }; f()`, 3},
+		{`try { for (x in 5) {} } catch (e) { e["message"] }`, "not iterable: INTEGER"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{
+			`len(1)`,
+			&object.Error{
+				Message: "argument to `len` not supported, got INTEGER",
+			},
+		},
+		{`len("one", "two")`,
+			&object.Error{
+				Message: "wrong number of arguments. got=2, want=1",
+			},
+		},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`first(1)`,
+			&object.Error{
+				Message: "argument to `first` must be ARRAY, got INTEGER",
+			},
+		},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`last(1)`,
+			&object.Error{
+				Message: "argument to `last` must be ARRAY, got INTEGER",
+			},
+		},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`,
+			&object.Error{
+				Message: "argument to `push` must be ARRAY, got INTEGER",
+			},
+		},
+		{`let f = fn(arr) { len(arr) }; f([1, 2])`, 2},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,,c", ",")`, []string{"a", "b", "", "c"}},
+		{`split("äbc", "")`, []string{"ä", "b", "c"}},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"], ", ")`, "1, true, x"},
+		{`join([], ",")`, ""},
+		{`trim("  \t monkey \n")`, "monkey"},
+		{`upper("äb")`, "ÄB"},
+		{`lower("ÄB")`, "äb"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "x")`, false},
+		{`if (contains("a", "a")) { "yes" } else { "no" }`, "yes"},
+		{`contains("a", "a") == true`, true},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`index_of("häystack", "st")`, 3},
+		{`index_of("abc", "x")`, -1},
+		{`substr("hällo", 1)`, "ällo"},
+		{`substr("hällo", 1, 3)`, "äll"},
+		{`substr("hällo", 4, 10)`, "o"},
+		{`substr("abc", 3)`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("", 1 << 70)`, ""},
+		{`chars("añb")`, []string{"a", "ñ", "b"}},
+		{`try { split("a") } catch (e) { e["message"] }`, "wrong number of arguments. got=1, want=2"},
+		{`try { split("a", 1) } catch (e) { e["message"] }`, "argument 2 to `split` must be STRING, got INTEGER"},
+		{`try { upper(1) } catch (e) { e["message"] }`, "argument to `upper` must be STRING, got INTEGER"},
+		{`try { join("a", ",") } catch (e) { e["message"] }`, "argument 1 to `join` must be ARRAY, got STRING"},
+		{`try { substr("abc") } catch (e) { e["message"] }`, "wrong number of arguments. got=1, want=2 or 3"},
+		{`try { substr("abc", 4) } catch (e) { e["message"] }`, "argument 2 to `substr` must be between 0 and 3, got 4"},
+		{`try { substr("abc", 0, -1) } catch (e) { e["message"] }`, "argument 3 to `substr` must not be negative, got -1"},
+		{`try { repeat("a", -1) } catch (e) { e["message"] }`, "argument 2 to `repeat` must not be negative, got -1"},
+		{`try { repeat("a", 1 << 70) } catch (e) { e["message"] }`, "argument 2 to `repeat` is too large, got 1180591620717411303424"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" < "abd"`, true},
+		{`"ab" < "abc"`, true},
+		{`"b" < "ä"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "c"`, false},
+		{`"b" > "a"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1] == [1, 1]`, false},
+		{`[1.0] == [1]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{} == []`, false},
+		{`1 == "1"`, false},
+		{`first([]) == first([])`, true},
+		{`first([]) == false`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let a = [1, 0]; a[1] = a; a == a`, true},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int{}},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, []int{11, 12}},
+		{`map(["a", "b"], upper)`, []string{"A", "B"}},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, []int{2, 4}},
+		{`filter([1, first([]), 2, false], fn(x) { x })`, []int{1, 2}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`reduce(range(1, 30), 1, fn(acc, x) { acc * x })`, bigInt("8841761993739701954543616000000")},
+		{`sort([3, 1.5, 2, -1])[1]`, 1.5},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort(["b", "ä", "a"])`, []string{"a", "b", "ä"}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`map(sort([[2, "b"], [1, "x"], [2, "a"]], fn(a, b) { a[0] < b[0] }), fn(p) { p[1] })`, []string{"x", "b", "a"}},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`any([], fn(x) { true })`, false},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, false},
+		{`range(4)`, []int{0, 1, 2, 3}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(10, 0, -3)`, []int{10, 7, 4, 1}},
+		{`range(5, 2)`, []int{}},
+		{`len(range(-9223372036854775807, 9223372036854775807, 4611686018427387904))`, 4},
+		{`zip([1, 2, 3], ["a", "b"])[1][1]`, "b"},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`enumerate(["a", "b"])[1][0]`, 1},
+		{`enumerate(["a", "b"])[1][1]`, "b"},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`reverse("häy")`, "yäh"},
+		{`contains([1, "a", 2.0], 2)`, true},
+		{`contains([1, "a"], "a")`, true},
+		{`contains([1, "a"], "b")`, false},
+		{`contains([[1, 2], {"a": 1}], {"a": 1})`, true},
+		{`contains([true, first([])], first([]))`, true},
+		{`let f = fn(n) { map(range(n), fn(x) { if (x > 0) { f(x) } else { 0 } }) }; len(f(4))`, 4},
+		{`try { map([1, 2], fn(x) { throw "boom" }) } catch (e) { e["message"] }`, "boom"},
+		{`try { map([1, 2], fn(x) { if (x == 2) { throw "two" }; x }) } catch (e) { e["message"] }`, "two"},
+		{`map([1, 2], fn(x) { try { throw "x" } catch (e) { x * 10 } })`, []int{10, 20}},
+		{`let r = try { map([1], fn(x) { x + true }) } catch (e) { 1 }; r + 1`, 2},
+		{`try { map([1], fn(a, b) { a }) } catch (e) { e["message"] }`, "wrong number of arguments: want=2, got=1"},
+		{`try { map([1], 2) } catch (e) { e["message"] }`, "argument 2 to `map` must be FUNCTION, got INTEGER"},
+		{`try { reduce([1], 0, 1) } catch (e) { e["message"] }`, "argument 3 to `reduce` must be FUNCTION, got INTEGER"},
+		{`try { sort([1, "a"]) } catch (e) { e["message"] }`, "cannot compare STRING and INTEGER"},
+		{`try { sort([1, 2], fn(a, b) { 1 }) } catch (e) { e["message"] }`, "sort function must return BOOLEAN, got INTEGER"},
+		{`try { range(1, 2, 0) } catch (e) { e["message"] }`, "range step must not be 0"},
+		{`try { range(1 << 40) } catch (e) { e["message"] }`, "range too large: 1099511627776 elements"},
+		{`try { reverse(1) } catch (e) { e["message"] }`, "argument to `reverse` not supported, got INTEGER"},
+		{`map([1], fn(x) { x + true })`, &object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({"b": 1, "a": 2, 3: 3})[0]`, "b"},
+		{`keys({"b": 1, "a": 2})`, []string{"b", "a"}},
+		{`values({"b": 1, "a": 2})`, []int{1, 2}},
+		{`items({"b": 1, "a": 2})[1][0]`, "a"},
+		{`items({"b": 1, "a": 2})[1][1]`, 2},
+		{`keys({})`, []int{}},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({1: 1}, 1.0)`, true},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); [len(h), len(d), d["b"]]`, []int{2, 1, 2}},
+		{`keys(delete({"a": 1}, "x"))`, []string{"a"}},
+		{`let h = merge({"a": 1, "b": 2}, {"b": 20, "c": 30}); values(h)`, []int{1, 20, 30}},
+		{`let h = {"a": 1}; h["c"] = 3; h["b"] = 2; h["a"] = 0; keys(h)`, []string{"a", "c", "b"}},
+		{`let h = delete({"a": 1, "b": 2}, "a"); h["a"] = 1; keys(h)`, []string{"b", "a"}},
+		{`let s = ""; for (k in {"z": 1, "y": 2, "x": 3}) { s += k }; s`, "zyx"},
+		{`format("%v", {"b": 1, "a": [2]})`, "{b: 1, a: [2]}"},
+		{`try { keys([1]) } catch (e) { e["message"] }`, "argument to `keys` must be HASH, got ARRAY"},
+		{`try { has({}, [1]) } catch (e) { e["message"] }`, "unusable as hash key: ARRAY"},
+		{`try { merge({}, 1) } catch (e) { e["message"] }`, "argument 2 to `merge` must be HASH, got INTEGER"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestCall(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let k = 3; fn(a, b) { a * b + k }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	fn := vm.LastPoppedStackElem()
+
+	result, err := vm.Call(fn, &object.Integer{Value: 2}, &object.Integer{Value: 5})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 13, result)
+
+	_, err = vm.Call(fn, &object.Integer{Value: 2})
+	if err == nil || err.Error() != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Errorf("vm not restored. sp=%d, framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t)
+
+	tests := []vmTestCase{
+		{`import "math"; math.double(21)`, 42},
+		{`import "math" as m; m.pi`, 3},
+		{`import "math.mk"; math.pi`, 3},
+		{`import "my-lib" as lib; lib.x`, 1},
+		{`import "math"; math["pi"]`, 3},
+		// the globals of a module are its own
+		{`import "math"; let helper = 1; math.double(helper)`, 2},
+		{`let pi = 4; import "math"; [pi, math.pi]`, []int{4, 3}},
+		{`import "math"; let getPi = fn() { math.pi }; getPi()`, 3},
+		// imports are relative to the importing module
+		{`import "lib/strings"; strings.twice("ab")`, "abab"},
+		{`import "lib/strings"; strings.quad(1)`, 4},
+		// a module runs once, every import gets the same namespace
+		{`import "math" as a; import "math" as b; a == b`, true},
+		{`import "lib/strings"; import "math"; strings.quad(1) + math.pi`, 7},
+		{`import "bump"; import "bumpmore"; import "bump" as again; import "state"; state.counter["n"]`, 11},
+		{`import "math"; try { math.nope } catch (e) { e["message"] }`, "module math has no export nope"},
+		{`import "math"; try { math.pi = 4 } catch (e) { e["message"] }`, "index assignment not supported: MODULE"},
+		{`import "fails"`, &object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.SetLoader(module.NewLoader([]string{dir}))
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if expectedErr, ok := tt.expected.(*object.Error); ok && err != nil {
+			if err.Error() != expectedErr.Message {
+				t.Errorf("wrong vm error. want=%q, got=%q", expectedErr.Message, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+// writeModules writes the modules the import tests use to a directory,
+// the tests find them in the search path
+func writeModules(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range testModules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write module: %s", err)
+		}
+	}
+	return dir
+}
+
+var testModules = map[string]string{
+	"math.mk": `
+	let helper = fn(x) { x * 2 };
+	export let double = fn(x) { helper(x) };
+	export let pi = 3;
+	`,
+	"lib/strings.mk": `
+	import "../math"
+	export let twice = fn(s) { s + s };
+	export let quad = fn(x) { math.double(math.double(x)) };
+	`,
+	"my-lib.mk":   `export let x = 1;`,
+	"state.mk":    `export let counter = {"n": 0};`,
+	"bump.mk":     `import "state"; state.counter["n"] += 1;`,
+	"bumpmore.mk": `import "state"; import "bump"; state.counter["n"] += 10;`,
+	"fails.mk":    `export let x = 1 + true;`,
+	"cycle_a.mk":  `import "cycle_b"`,
+	"cycle_b.mk":  `import "cycle_a"`,
+	"broken.mk":   `let x = ;`,
+	"undefined.mk": `
+	export let f = fn() { nope };
+	`,
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newClosure = fn(a) {
+				fn() { a; };
+			};
+			let closure = newClosure(99);
+			closure();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let adder = fn(a) { fn(b) { a + b } };
+			let addTwo = adder(2);
+			addTwo(3);
+			`,
+			expected: 5,
+		},
+		{
+			input: `
+			let newAdder = fn(a, b) {
+				fn(c) { a + b + c };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+			expected: 11,
+		},
+		{
+			input: `
+			let newAdder = fn(a, b) {
+				let c = a + b;
+				fn(d) { c + d };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+			expected: 11,
+		},
+		{
+			input: `
+			let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+		{
+			input: `
+			let a = 1;
+			let newAdderOuter = fn(b) {
+				fn(c) {
+					fn(d) { a + b + c + d };
+				};
+			};
+			let newAdderInner = newAdderOuter(2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+		{
+			input: `
+			let newClosure = fn(a, b) {
+				let one = fn() { a; };
+				let two = fn() { b; };
+				fn() { one() + two(); };
+			};
+			let closure = newClosure(9, 90);
+			closure();
+			`,
+			expected: 99,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+			`,
+			expected: 0,
+		},
+		{
+			input: `
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			let wrapper = fn() {
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expected: 0,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) {
+						return 0;
+					} else {
+						countDown(x - 1);
+					}
+				};
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expected: 0,
+		},
+		{
+			// as deep as the evaluator goes for scripts
+			input: `
+			let deep = fn(n) { if (n == 0) { 0 } else { deep(n - 1) + 1 } };
+			deep(10000);
+			`,
+			expected: 10000,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestMutuallyRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			isEven(10);
+			`,
+			expected: true,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+				let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+				isOdd(7);
+			};
+			wrapper();
+			`,
+			expected: true,
+		},
+		{
+			input: `
+			let wrapper = fn(start) {
+				let ping = fn(n) { if (n == 0) { "ping" } else { pong(n - 1) } };
+				let pong = fn(n) { if (n == 0) { "pong" } else { ping(n - 1) } };
+				let both = fn() { ping(start) + pong(start) };
+				both();
+			};
+			wrapper(3);
+			`,
+			expected: "pongping",
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestUnsetVariables(t *testing.T) {
+	tests := []vmTestCase{
+		// a function may call a hoisted function before its let statement ran
+		{`let k = fn() { h() }; k(); let h = fn() { 1 };`, &object.Error{Message: "identifier not found: h"}},
+		{`if (false) { let z = 1 }; z`, &object.Error{Message: "identifier not found: z"}},
+		// the locals of a call don't start out with what an earlier call left behind
+		{`
+		let g = fn() { if (false) { let z = 1 }; z };
+		let f = fn() { let a = 2; a };
+		f();
+		try { g() } catch (e) { e["message"] }
+		`, "identifier not found: z"},
+		// a closure reading a captured function before its let statement ran
+		{`let f = fn() { let k = fn() { h() }; let x = k(); let h = fn() { 1 }; x }; try { f() } catch (e) { e["message"] }`,
+			"identifier not found: h"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRecursiveFibonacci(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let fibonacci = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					if (x == 1) {
+						return 1;
+					} else {
+						fibonacci(x - 1) + fibonacci(x - 2);
+					}
+				}
+			};
+			fibonacci(15);
+			`,
+			expected: 610,
+		},
+		{
+			input: `
+			let wrapper = fn(n) {
+				let fibonacci = fn(x) {
+					if (x < 2) { return x; }
+					fibonacci(x - 1) + fibonacci(x - 2);
+				};
+				fibonacci(n);
+			};
+			wrapper(15);
+			`,
+			expected: 610,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
 // Helper testing Functions
 
 func testExpectedObject(
@@ -300,6 +1411,22 @@ func testExpectedObject(
 			t.Errorf("vm: testIntegerObject failed: %s", err)
 		}
 
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("vm: testFloatObject failed: %s", err)
+		}
+
+	case *big.Int:
+		integer, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("vm: testExpectedObject: object is not BigInt. got=%T (%+v)", actual, actual)
+			return
+		}
+		if integer.Value.Cmp(expected) != 0 {
+			t.Errorf("vm: testExpectedObject: BigInt has wrong value. want=%s, got=%s", expected, integer.Value)
+		}
+
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -312,6 +1439,25 @@ func testExpectedObject(
 			t.Errorf("vm: testStringObject failed: %s", err)
 		}
 
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("vm: testExpectedObject: object is not an Array. got=%T (%+v)",
+				actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("vm: testExpectedObject: array has wrong number of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			err := testStringObject(expectedElem, array.Elements[i])
+			if err != nil {
+				t.Errorf("vm: testStringObject failed (array): %s", err)
+			}
+		}
+
 	case []int:
 		array, ok := actual.(*object.Array)
 		if !ok {
@@ -337,15 +1483,16 @@ func testExpectedObject(
 			t.Errorf("vm: testExpectedObject: object is not a Hash. got=%T (%+v)", actual, actual)
 			return
 		}
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("vm: testExpectedObject: Hash has wrong number of Pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 			return
 		}
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+		for _, pair := range hash.Pairs() {
+			expectedKey := pair.Key.(object.Hashable).HashKey()
+			expectedValue, ok := expected[expectedKey]
 			if !ok {
-				t.Errorf("vm: testExpectedObject: no pair for given key in hash.Pairs")
+				t.Errorf("vm: testExpectedObject: unexpected key in hash.Pairs: %s", pair.Key.Inspect())
 			}
 			err := testIntegerObject(expectedValue, pair.Value)
 			if err != nil {
@@ -353,6 +1500,17 @@ func testExpectedObject(
 			}
 		}
 
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("vm: testExpectedObject: object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("vm: testExpectedObject: wrong error message. want=%q, got=%q",
+				expected.Message, errObj.Message)
+		}
+
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("vm: testNullObject failed: object is not Null: %T (%+v)", actual, actual)
@@ -360,6 +1518,14 @@ func testExpectedObject(
 	}
 }
 
+func bigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer " + s)
+	}
+	return v
+}
+
 func testIntegerObject(expected int64, actual object.Object) error {
 	result, ok := actual.(*object.Integer)
 	if !ok {
@@ -375,6 +1541,21 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil // no errors when testing integers
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("float: object is not Float. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("float: object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {